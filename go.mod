@@ -5,7 +5,11 @@ go 1.22.2
 require github.com/joho/godotenv v1.5.1
 
 require (
+	github.com/andybalholm/brotli v1.1.1
 	github.com/google/uuid v1.6.0
 	github.com/gorilla/mux v1.8.1
-	github.com/lib/pq v1.10.9 // indirect
+	github.com/lib/pq v1.10.9
+	golang.org/x/net v0.30.0
 )
+
+require golang.org/x/text v0.19.0 // indirect
@@ -0,0 +1,139 @@
+package httpfunctions
+
+import (
+	"encoding/xml"
+	"strings"
+)
+
+type AtomFeed struct {
+	Title    string       `xml:"title"`
+	Subtitle string       `xml:"subtitle"`
+	Lang     string       `xml:"lang,attr"`
+	Link     []AtomLink   `xml:"link"`
+	Author   []AtomPerson `xml:"author"`
+	Entry    []AtomEntry  `xml:"entry"`
+}
+
+type AtomEntry struct {
+	ID        string         `xml:"id"`
+	Title     string         `xml:"title"`
+	Link      []AtomLink     `xml:"link"`
+	Updated   string         `xml:"updated"`
+	Published string         `xml:"published"`
+	Summary   AtomText       `xml:"summary"`
+	Content   AtomText       `xml:"content"`
+	Author    []AtomPerson   `xml:"author"`
+	Category  []AtomCategory `xml:"category"`
+}
+
+type AtomPerson struct {
+	Name string `xml:"name"`
+}
+
+type AtomCategory struct {
+	Term  string `xml:"term,attr"`
+	Label string `xml:"label,attr"`
+}
+
+// AtomText is a text construct, which holds escaped markup unless its type is xhtml
+type AtomText struct {
+	Type     string `xml:"type,attr"`
+	Text     string `xml:",chardata"`
+	InnerXML string `xml:",innerxml"`
+}
+
+type AtomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+	Type string `xml:"type,attr"`
+}
+
+func (atomFeed AtomFeed) toParsedFeed() ParsedFeed {
+	feed := ParsedFeed{
+		Title:       atomFeed.Title,
+		Link:        alternateLink(atomFeed.Link),
+		Description: atomFeed.Subtitle,
+		Language:    atomFeed.Lang,
+	}
+	for _, entry := range atomFeed.Entry {
+		// published is optional in Atom, updated is always present
+		pubDate := entry.Published
+		if pubDate == "" {
+			pubDate = entry.Updated
+		}
+
+		content := entry.Content.value()
+		description := entry.Summary.value()
+		if description == "" {
+			description = content
+		}
+
+		// Entries without an author inherit the feed's
+		authors := entry.Author
+		if len(authors) == 0 {
+			authors = atomFeed.Author
+		}
+		var categories []string
+		for _, category := range entry.Category {
+			categories = append(categories, category.Term)
+		}
+
+		feed.Items = append(feed.Items, FeedItem{
+			GUID:        entry.ID,
+			Title:       entry.Title,
+			Link:        alternateLink(entry.Link),
+			Description: description,
+			Content:     content,
+			PubDate:     pubDate,
+			Author:      firstAuthor(authors),
+			Categories:  categories,
+		})
+	}
+	return feed
+}
+
+// alternateLink picks the rel="alternate" link, which is the default when rel is omitted
+func alternateLink(links []AtomLink) string {
+	for _, link := range links {
+		if link.Rel == "" || link.Rel == "alternate" {
+			return link.Href
+		}
+	}
+	if len(links) > 0 {
+		return links[0].Href
+	}
+	return ""
+}
+
+func firstAuthor(authors []AtomPerson) string {
+	for _, author := range authors {
+		if name := strings.TrimSpace(author.Name); name != "" {
+			return name
+		}
+	}
+	return ""
+}
+
+func (text AtomText) value() string {
+	if text.Type == "xhtml" {
+		return xhtmlContent(text.InnerXML)
+	}
+	return strings.TrimSpace(text.Text)
+}
+
+// xhtmlContent strips the div wrapping xhtml content, RFC 4287 does not count it as content
+func xhtmlContent(inner string) string {
+	inner = strings.TrimSpace(inner)
+	decoder := xml.NewDecoder(strings.NewReader(inner))
+	token, err := decoder.Token()
+	if start, ok := token.(xml.StartElement); err != nil || !ok || start.Name.Local != "div" {
+		return inner
+	}
+	offset := int(decoder.InputOffset())
+	end := strings.LastIndex(inner, "</")
+	if end < offset {
+		// A self-closing <div/> holds nothing
+		return ""
+	}
+	return strings.TrimSpace(inner[offset:end])
+}
@@ -0,0 +1,116 @@
+package httpfunctions
+
+import (
+	"reflect"
+	"testing"
+)
+
+const atomSample = `<?xml version="1.0" encoding="utf-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom" xml:lang="en">
+  <title>Example Atom</title>
+  <subtitle>All the news</subtitle>
+  <link rel="self" href="https://example.com/atom.xml"/>
+  <link href="https://example.com/"/>
+  <author><name>Feed Author</name></author>
+  <entry>
+    <id>urn:uuid:1225c695-cfb8-4ebb-aaaa-80da344efa6a</id>
+    <title>Published entry</title>
+    <link rel="alternate" type="text/html" href="https://example.com/published"/>
+    <link rel="edit" href="https://example.com/edit/1"/>
+    <published>2006-01-02T15:04:05Z</published>
+    <updated>2006-01-05T00:00:00Z</updated>
+    <summary>Short summary</summary>
+    <content type="html">&lt;p&gt;Full content&lt;/p&gt;</content>
+    <author><name> Entry Author </name></author>
+    <category term="go" label="Go"/>
+  </entry>
+  <entry>
+    <id>tag:example.com,2006:2</id>
+    <title>Updated only</title>
+    <link href="https://example.com/updated"/>
+    <updated>2006-01-06T00:00:00Z</updated>
+    <content type="xhtml"><div xmlns="http://www.w3.org/1999/xhtml"><p>Inline</p></div></content>
+  </entry>
+</feed>`
+
+func TestParseFeedAtom(t *testing.T) {
+	feed, err := parseFeed("application/atom+xml", []byte(atomSample))
+	if err != nil {
+		t.Fatalf("parseFeed returned error: %v", err)
+	}
+
+	if feed.Title != "Example Atom" || feed.Link != "https://example.com/" || feed.Description != "All the news" || feed.Language != "en" {
+		t.Errorf("feed = %q %q %q %q", feed.Title, feed.Link, feed.Description, feed.Language)
+	}
+
+	xhtml := `<p>Inline</p>`
+	want := []FeedItem{
+		{
+			GUID:        "urn:uuid:1225c695-cfb8-4ebb-aaaa-80da344efa6a",
+			Title:       "Published entry",
+			Link:        "https://example.com/published",
+			Description: "Short summary",
+			Content:     "<p>Full content</p>",
+			PubDate:     "2006-01-02T15:04:05Z",
+			Author:      "Entry Author",
+			Categories:  []string{"go"},
+		},
+		{
+			GUID:        "tag:example.com,2006:2",
+			Title:       "Updated only",
+			Link:        "https://example.com/updated",
+			Description: xhtml,
+			Content:     xhtml,
+			PubDate:     "2006-01-06T00:00:00Z",
+			Author:      "Feed Author",
+		},
+	}
+	if !reflect.DeepEqual(feed.Items, want) {
+		t.Errorf("Items = %+v, want %+v", feed.Items, want)
+	}
+}
+
+func TestAtomTextValue(t *testing.T) {
+	tests := []struct {
+		name string
+		text AtomText
+		want string
+	}{
+		{"text", AtomText{Text: "  Plain  "}, "Plain"},
+		{"escaped html", AtomText{Type: "html", Text: "<p>Hi</p>"}, "<p>Hi</p>"},
+		{"xhtml div removed", AtomText{Type: "xhtml", InnerXML: `
+			<div xmlns="http://www.w3.org/1999/xhtml"> <p>Hi <b>there</b></p> </div>
+		`}, "<p>Hi <b>there</b></p>"},
+		{"prefixed div removed", AtomText{Type: "xhtml", InnerXML: `<xhtml:div xmlns:xhtml="http://www.w3.org/1999/xhtml">Hi</xhtml:div>`}, "Hi"},
+		{"nested divs kept", AtomText{Type: "xhtml", InnerXML: `<div><div>a</div><div>b</div></div>`}, "<div>a</div><div>b</div>"},
+		{"empty div", AtomText{Type: "xhtml", InnerXML: `<div xmlns="http://www.w3.org/1999/xhtml"/>`}, ""},
+		{"no wrapping div", AtomText{Type: "xhtml", InnerXML: `<p>Hi</p>`}, "<p>Hi</p>"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.text.value(); got != test.want {
+				t.Errorf("value() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestAlternateLink(t *testing.T) {
+	tests := []struct {
+		name  string
+		links []AtomLink
+		want  string
+	}{
+		{"no links", nil, ""},
+		{"rel omitted", []AtomLink{{Rel: "self", Href: "https://example.com/self"}, {Href: "https://example.com/"}}, "https://example.com/"},
+		{"explicit alternate", []AtomLink{{Rel: "alternate", Href: "https://example.com/a"}}, "https://example.com/a"},
+		{"first link as fallback", []AtomLink{{Rel: "self", Href: "https://example.com/self"}}, "https://example.com/self"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := alternateLink(test.links); got != test.want {
+				t.Errorf("alternateLink() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
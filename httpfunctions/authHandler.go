@@ -1,7 +1,6 @@
 package httpfunctions
 
 import (
-	"context"
 	"net/http"
 	"strings"
 
@@ -12,7 +11,7 @@ type authedHandler func(http.ResponseWriter, *http.Request, database.User)
 
 func (apiConfig *ApiConfig) middlewareAuth(handler authedHandler) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		ctx := context.Background()
+		ctx := r.Context()
 		authHeader := r.Header.Get("Authorization")
 		const prefix = "ApiKey "
 		var apiKey string
@@ -0,0 +1,70 @@
+package httpfunctions
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"mime"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html/charset"
+)
+
+// xmlEncoding finds the encoding in an XML declaration
+var xmlEncoding = regexp.MustCompile(`^\s*<\?xml[^>]*?encoding\s*=\s*["']([A-Za-z0-9._:-]+)["']`)
+
+// toUTF8 transcodes a document to UTF-8. The charset comes from the Content-Type header,
+// then the byte order mark, then the XML declaration. Bytes that are still invalid and
+// control characters XML forbids are dropped rather than failing the whole feed
+func toUTF8(contentType string, body []byte) []byte {
+	label := ""
+	if _, params, err := mime.ParseMediaType(contentType); err == nil {
+		label = params["charset"]
+	}
+	switch {
+	case bytes.HasPrefix(body, []byte("\xef\xbb\xbf")):
+		body, label = body[3:], "utf-8"
+	case bytes.HasPrefix(body, []byte("\xfe\xff")) && label == "":
+		label = "utf-16be"
+	case bytes.HasPrefix(body, []byte("\xff\xfe")) && label == "":
+		label = "utf-16le"
+	}
+	if label == "" {
+		if match := xmlEncoding.FindSubmatch(body); match != nil {
+			label = string(match[1])
+		}
+	}
+
+	label = strings.ToLower(strings.TrimSpace(label))
+	if label != "" && label != "utf-8" && label != "utf8" {
+		reader, err := charset.NewReaderLabel(label, bytes.NewReader(body))
+		if err == nil {
+			decoded, err := io.ReadAll(reader)
+			if err == nil {
+				// A UTF-16 byte order mark decodes to one in UTF-8
+				body = bytes.TrimPrefix(decoded, []byte("\xef\xbb\xbf"))
+			}
+		}
+	}
+
+	body = bytes.ToValidUTF8(body, []byte("\uFFFD"))
+	return bytes.Map(func(r rune) rune {
+		if (r < 0x20 && r != '\t' && r != '\n' && r != '\r') || r == 0xFFFE || r == 0xFFFF {
+			return -1
+		}
+		return r
+	}, body)
+}
+
+// newXMLDecoder decodes a document already converted by toUTF8. The encoding in the XML
+// declaration is ignored as it no longer applies, and HTML entities such as &nbsp; that
+// feeds often use without declaring them are understood
+func newXMLDecoder(body []byte) *xml.Decoder {
+	decoder := xml.NewDecoder(bytes.NewReader(body))
+	decoder.CharsetReader = func(label string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}
+	decoder.Entity = xml.HTMLEntity
+	return decoder
+}
@@ -0,0 +1,46 @@
+package httpfunctions
+
+import "testing"
+
+func TestToUTF8(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		want        string
+	}{
+		{"already UTF-8", "text/xml", "<t>café</t>", "<t>café</t>"},
+		{"charset from header", "text/xml; charset=ISO-8859-1", "<t>caf\xe9</t>", "<t>café</t>"},
+		{"charset from declaration", "text/xml", `<?xml version="1.0" encoding="windows-1252"?><t>` + "\x93quoted\x94</t>",
+			`<?xml version="1.0" encoding="windows-1252"?><t>“quoted”</t>`},
+		{"header wins over declaration", "text/xml; charset=utf-8", `<?xml version="1.0" encoding="iso-8859-1"?><t>café</t>`,
+			`<?xml version="1.0" encoding="iso-8859-1"?><t>café</t>`},
+		{"UTF-8 byte order mark", "", "\xef\xbb\xbf<t>café</t>", "<t>café</t>"},
+		{"UTF-16 byte order mark", "", "\xff\xfe<\x00t\x00>\x00\xe9\x00<\x00/\x00t\x00>\x00", "<t>é</t>"},
+		{"unknown charset left alone", "text/xml; charset=x-unknown", "<t>ok</t>", "<t>ok</t>"},
+		{"invalid bytes replaced", "", "<t>a\xffb</t>", "<t>a\uFFFDb</t>"},
+		{"control characters dropped", "", "<t>a\x00\x08b\tc\n</t>", "<t>ab\tc\n</t>"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := string(toUTF8(test.contentType, []byte(test.body))); got != test.want {
+				t.Errorf("toUTF8() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseFeedLatin1(t *testing.T) {
+	body := `<?xml version="1.0" encoding="ISO-8859-1"?>` +
+		"<rss version=\"2.0\"><channel><title>Caf\xe9</title><item><title>Cr\xe8me br\xfbl\xe9e</title></item></channel></rss>"
+	feed, err := parseFeed("application/xml", []byte(body))
+	if err != nil {
+		t.Fatalf("parseFeed returned error: %v", err)
+	}
+	if feed.Title != "Café" {
+		t.Errorf("Title = %q, want %q", feed.Title, "Café")
+	}
+	if len(feed.Items) != 1 || feed.Items[0].Title != "Crème brûlée" {
+		t.Errorf("Items = %+v, want one item titled %q", feed.Items, "Crème brûlée")
+	}
+}
@@ -0,0 +1,250 @@
+package httpfunctions
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// dateLayouts are tried in order against a date normalised by normaliseDate,
+// which strips weekdays and commas and translates month names to English
+var dateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02T15:04:05-0700",
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05Z07:00",
+	"2006-01-02 15:04:05 -0700",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	"2 Jan 2006 15:04:05 -0700",
+	"2 Jan 2006 15:04:05 -07:00",
+	"2 Jan 2006 15:04 -0700",
+	"2 Jan 2006 15:04:05",
+	"2 Jan 2006 15:04",
+	"2 Jan 06 15:04:05 -0700",
+	"2 Jan 06 15:04 -0700",
+	"2 Jan 06 15:04:05",
+	"2 Jan 2006",
+	"Jan 2 2006 15:04:05 -0700",
+	"Jan 2 2006 15:04:05",
+	"Jan 2 2006 15:04",
+	"Jan 2 15:04:05 -0700 2006",
+	"Jan 2 15:04:05 2006",
+	"Jan 2 2006",
+
+	// 12-hour clocks, normaliseDate keeps the AM/PM marker so these never match a 24-hour layout
+	"2006-01-02 3:04:05 PM -0700",
+	"2006-01-02 3:04:05 PM",
+	"2006-01-02 3:04 PM",
+	"2 Jan 2006 3:04:05 PM -0700",
+	"2 Jan 2006 3:04 PM -0700",
+	"2 Jan 2006 3:04:05 PM",
+	"2 Jan 2006 3:04 PM",
+	"Jan 2 2006 3:04:05 PM -0700",
+	"Jan 2 2006 3:04:05 PM",
+	"Jan 2 2006 3:04 PM",
+	"1/2/2006 3:04:05 PM",
+	"1/2/2006 3:04 PM",
+}
+
+// zoneOffsets maps the zone abbreviations seen in feeds to their offsets, time.Parse
+// would otherwise silently treat any abbreviation it does not know as UTC
+var zoneOffsets = map[string]string{
+	"UT": "+0000", "UTC": "+0000", "GMT": "+0000", "Z": "+0000", "WET": "+0000",
+	"EST": "-0500", "EDT": "-0400", "CST": "-0600", "CDT": "-0500",
+	"MST": "-0700", "MDT": "-0600", "PST": "-0800", "PDT": "-0700",
+	"AKST": "-0900", "AKDT": "-0800", "HST": "-1000",
+	"BST": "+0100", "IST": "+0530", "CET": "+0100", "CEST": "+0200", "WEST": "+0100",
+	"EET": "+0200", "EEST": "+0300", "MSK": "+0300",
+	"SGT": "+0800", "HKT": "+0800", "AWST": "+0800", "JST": "+0900", "KST": "+0900",
+	"ACST": "+0930", "AEST": "+1000", "AEDT": "+1100", "NZST": "+1200", "NZDT": "+1300",
+}
+
+// monthNames maps English and common non-English month names and abbreviations to
+// the English abbreviation used in dateLayouts
+var monthNames = map[string]string{}
+
+// weekdayNames holds English and common non-English weekday names and abbreviations
+var weekdayNames = map[string]bool{}
+
+func init() {
+	months := [][]string{
+		{"jan", "january", "januar", "janvier", "janv", "enero", "ene", "gennaio", "gen", "januari", "janeiro"},
+		{"feb", "february", "februar", "février", "fevrier", "févr", "fevr", "febrero", "febbraio", "februari", "fevereiro", "fev"},
+		{"mar", "march", "märz", "marz", "mär", "mrz", "mars", "marzo", "maart", "mrt", "março", "marco"},
+		{"apr", "april", "avril", "avr", "abril", "abr", "aprile"},
+		{"may", "mai", "mayo", "maggio", "mag", "mei", "maio"},
+		{"jun", "june", "juni", "juin", "junio", "giugno", "giu", "junho"},
+		{"jul", "july", "juli", "juillet", "juil", "julio", "luglio", "lug", "julho"},
+		{"aug", "august", "août", "aout", "agosto", "ago", "augustus"},
+		{"sep", "sept", "september", "septembre", "septiembre", "setiembre", "settembre", "set", "setembro"},
+		{"oct", "october", "oktober", "okt", "octobre", "octubre", "ottobre", "ott", "outubro", "out"},
+		{"nov", "november", "novembre", "noviembre", "novembro"},
+		{"dec", "december", "dezember", "dez", "décembre", "diciembre", "dic", "dicembre", "dezembro"},
+	}
+	for i, names := range months {
+		english := time.Month(i + 1).String()[:3]
+		for _, name := range names {
+			monthNames[name] = english
+		}
+	}
+
+	weekdays := []string{
+		"mon", "tue", "tues", "wed", "thu", "thur", "thurs", "fri", "sat", "sun",
+		"monday", "tuesday", "wednesday", "thursday", "friday", "saturday", "sunday",
+		"montag", "dienstag", "mittwoch", "donnerstag", "freitag", "samstag", "sonnabend", "sonntag",
+		"mo", "di", "mi", "do", "fr", "sa", "so",
+		"lundi", "mardi", "mercredi", "jeudi", "vendredi", "samedi", "dimanche",
+		"lun", "mer", "jeu", "ven", "sam", "dim",
+		"lunes", "martes", "miércoles", "jueves", "viernes", "sábado", "domingo",
+		"mié", "jue", "vie", "sáb", "dom",
+		"lunedì", "martedì", "mercoledì", "giovedì", "venerdì", "sabato", "domenica",
+		"maandag", "dinsdag", "woensdag", "donderdag", "vrijdag", "zaterdag", "zondag",
+		"ma", "wo", "vr", "za", "zo",
+	}
+	for _, name := range weekdays {
+		weekdayNames[name] = true
+	}
+}
+
+// parsePubDate parses the publication date of a feed item in any of the formats seen in the wild
+func parsePubDate(value string) (time.Time, error) {
+	normalised := normaliseDate(value)
+	if normalised == "" {
+		return time.Time{}, fmt.Errorf("empty date")
+	}
+	for _, layout := range dateLayouts {
+		t, err := time.Parse(layout, normalised)
+		if err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognised date format %q", value)
+}
+
+// normaliseDate rewrites a date into a form that dateLayouts can match: the weekday,
+// commas and ordinal suffixes are dropped, month names become English abbreviations,
+// zone abbreviations become numeric offsets and AM/PM markers become a separate AM or PM
+func normaliseDate(value string) string {
+	tokens := splitMeridiem(strings.Fields(value))
+	normalised := make([]string, 0, len(tokens))
+	for i, token := range tokens {
+		word := strings.ToLower(strings.TrimRight(token, ",."))
+
+		// The weekday only ever leads and is redundant, French "mar" is also March though
+		if i == 0 && isLetters(word) && (strings.HasSuffix(token, ",") || (weekdayNames[word] && monthNames[word] == "")) {
+			continue
+		}
+		if meridiem, ok := meridiems[strings.ReplaceAll(word, ".", "")]; ok {
+			normalised = append(normalised, meridiem)
+			continue
+		}
+		if month, ok := monthNames[word]; ok {
+			normalised = append(normalised, month)
+			continue
+		}
+		if offset, ok := zoneOffset(strings.TrimRight(token, ",.")); ok {
+			normalised = append(normalised, offset)
+			continue
+		}
+		if isLetters(word) && len(word) > 0 && strings.ToUpper(token) == token {
+			// Unknown zone abbreviation, treat the time as UTC
+			continue
+		}
+		token = strings.ReplaceAll(token, ",", "")
+		if day := strings.TrimSuffix(token, "."); isDigits(day) {
+			// German style ordinal days, as in 2. Januar
+			token = day
+		}
+		token = trimOrdinal(token)
+		if token != "" {
+			normalised = append(normalised, token)
+		}
+	}
+	return strings.Join(normalised, " ")
+}
+
+// meridiems maps the AM/PM markers, written without dots, to the form time.Parse expects
+var meridiems = map[string]string{"am": "AM", "pm": "PM"}
+
+// splitMeridiem separates markers written against the time, as in 3:04PM
+func splitMeridiem(tokens []string) []string {
+	split := make([]string, 0, len(tokens))
+	for _, token := range tokens {
+		lower := strings.ToLower(token)
+		for marker := range meridiems {
+			clock, found := strings.CutSuffix(lower, marker)
+			if found && strings.Contains(clock, ":") && isDigits(strings.ReplaceAll(clock, ":", "")) {
+				split = append(split, clock)
+				token = marker
+				break
+			}
+		}
+		split = append(split, token)
+	}
+	return split
+}
+
+// zoneOffset resolves zone abbreviations, including forms like GMT+0200 and UTC+2
+func zoneOffset(token string) (string, bool) {
+	if offset, ok := zoneOffsets[strings.ToUpper(token)]; ok {
+		return offset, true
+	}
+	for _, prefix := range []string{"GMT", "UTC", "UT"} {
+		rest, found := strings.CutPrefix(strings.ToUpper(token), prefix)
+		if !found || len(rest) < 2 || (rest[0] != '+' && rest[0] != '-') {
+			continue
+		}
+		digits := strings.ReplaceAll(rest[1:], ":", "")
+		if !isDigits(digits) {
+			return "", false
+		}
+		switch len(digits) {
+		case 1:
+			digits = "0" + digits + "00"
+		case 2:
+			digits += "00"
+		case 3:
+			digits = "0" + digits
+		case 4:
+		default:
+			return "", false
+		}
+		return rest[:1] + digits, true
+	}
+	return "", false
+}
+
+// trimOrdinal turns 1st, 2nd, 3rd and 4th into plain day numbers
+func trimOrdinal(token string) string {
+	lower := strings.ToLower(token)
+	for _, suffix := range []string{"st", "nd", "rd", "th"} {
+		day, found := strings.CutSuffix(lower, suffix)
+		if found && len(day) > 0 && len(day) <= 2 && isDigits(day) {
+			return day
+		}
+	}
+	return token
+}
+
+func isLetters(value string) bool {
+	for _, r := range value {
+		if !unicode.IsLetter(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func isDigits(value string) bool {
+	for _, r := range value {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,52 @@
+package httpfunctions
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParsePubDate(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  time.Time
+	}{
+		{"RFC1123Z", "Mon, 02 Jan 2006 15:04:05 -0700", time.Date(2006, 1, 2, 22, 4, 5, 0, time.UTC)},
+		{"RFC1123 GMT", "Mon, 02 Jan 2006 15:04:05 GMT", time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)},
+		{"RFC1123 named zone", "Mon, 02 Jan 2006 15:04:05 EST", time.Date(2006, 1, 2, 20, 4, 5, 0, time.UTC)},
+		{"RFC1123 GMT offset", "Mon, 02 Jan 2006 15:04:05 GMT+0200", time.Date(2006, 1, 2, 13, 4, 5, 0, time.UTC)},
+		{"single digit day without seconds", "Tue, 3 Jan 2006 15:04 +0000", time.Date(2006, 1, 3, 15, 4, 0, 0, time.UTC)},
+		{"RFC3339", "2006-01-02T15:04:05Z", time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)},
+		{"RFC3339 offset and fraction", "2006-01-02T15:04:05.123+02:00", time.Date(2006, 1, 2, 13, 4, 5, 123000000, time.UTC)},
+		{"ISO without zone", "2006-01-02T15:04:05", time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)},
+		{"ISO with space", "2006-01-02 15:04", time.Date(2006, 1, 2, 15, 4, 0, 0, time.UTC)},
+		{"date only", "2006-01-02", time.Date(2006, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{"German month", "Montag, 2. Januar 2006 15:04:05 +0100", time.Date(2006, 1, 2, 14, 4, 5, 0, time.UTC)},
+		{"French month", "2 févr. 2006", time.Date(2006, 2, 2, 0, 0, 0, 0, time.UTC)},
+		{"ordinal day", "January 2nd 2006", time.Date(2006, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{"PM", "Mon, 02 Jan 2006 03:04 PM", time.Date(2006, 1, 2, 15, 4, 0, 0, time.UTC)},
+		{"AM", "Mon, 02 Jan 2006 03:04:05 AM -0500", time.Date(2006, 1, 2, 8, 4, 5, 0, time.UTC)},
+		{"12 AM is midnight", "Jan 2 2006 12:30 AM", time.Date(2006, 1, 2, 0, 30, 0, 0, time.UTC)},
+		{"lowercase attached marker", "2006-01-02 3:04pm", time.Date(2006, 1, 2, 15, 4, 0, 0, time.UTC)},
+		{"dotted marker", "1/2/2006 3:04 p.m.", time.Date(2006, 1, 2, 15, 4, 0, 0, time.UTC)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := parsePubDate(test.value)
+			if err != nil {
+				t.Fatalf("parsePubDate(%q) returned error: %v", test.value, err)
+			}
+			if !got.Equal(test.want) {
+				t.Errorf("parsePubDate(%q) = %v, want %v", test.value, got.UTC(), test.want)
+			}
+		})
+	}
+}
+
+func TestParsePubDateRejects(t *testing.T) {
+	for _, value := range []string{"", "yesterday", "Mon, 02 Jan 2006 15:04 PM", "32 Jan 2006"} {
+		if got, err := parsePubDate(value); err == nil {
+			t.Errorf("parsePubDate(%q) = %v, want an error", value, got)
+		}
+	}
+}
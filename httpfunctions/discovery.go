@@ -0,0 +1,250 @@
+package httpfunctions
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+// ErrNoFeedFound is returned by DiscoverFeeds when a page advertises no feed and none of
+// the common feed paths hold one
+var ErrNoFeedFound = errors.New("no feed found")
+
+// feedMediaTypes are the link types that advertise a feed
+var feedMediaTypes = map[string]bool{
+	"application/rss+xml":   true,
+	"application/atom+xml":  true,
+	"application/rdf+xml":   true,
+	"application/feed+json": true,
+}
+
+// commonFeedPaths are tried in order when a page does not advertise its feed, first in the
+// page's directory and then at the root of the site. The list is kept short as every path
+// is a request that usually fails
+var commonFeedPaths = []string{"feed", "rss.xml", "atom.xml", "index.xml"}
+
+// feedProbeTimeout bounds each request for a common feed path, most of them are missing
+// and a slow site must not hold up the whole discovery
+const feedProbeTimeout = 5 * time.Second
+
+// FeedCandidate is a feed found while looking at a URL
+type FeedCandidate struct {
+	Url   string `json:"url"`
+	Title string `json:"title"`
+	Type  string `json:"type"`
+	// result is the feed as fetched during discovery, nil for feeds only linked from a page
+	result *FetchResult
+}
+
+// document is a response fetched while discovering feeds
+type document struct {
+	contentType string
+	body        []byte
+	// url is where the request ended up after redirects
+	url          string
+	validators   Validators
+	permanentURL string
+}
+
+// feedCandidate parses the document as a feed requested from requestURL
+func (doc document) feedCandidate(requestURL string) (FeedCandidate, error) {
+	feed, err := parseFeed(doc.contentType, doc.body)
+	if err != nil {
+		return FeedCandidate{}, err
+	}
+	return FeedCandidate{
+		Url:   requestURL,
+		Title: feed.Title,
+		Type:  mediaType(doc.contentType),
+		result: &FetchResult{
+			Feed:         feed,
+			Validators:   doc.validators,
+			PermanentURL: doc.permanentURL,
+		},
+	}, nil
+}
+
+// DiscoverFeeds finds the feeds behind pageURL. A URL that already is a feed is returned
+// as is, for a web page the feeds it links with <link rel="alternate"> are returned, and
+// failing that the first common feed path holding a feed. Feeds fetched along the way keep
+// their FetchResult, so they need not be fetched again
+func (fetcher *Fetcher) DiscoverFeeds(ctx context.Context, pageURL string) ([]FeedCandidate, error) {
+	page, err := fetcher.fetchDocument(ctx, pageURL)
+	if err != nil {
+		return nil, err
+	}
+	if candidate, err := page.feedCandidate(pageURL); err == nil {
+		return []FeedCandidate{candidate}, nil
+	}
+
+	if isHTML(page.contentType, page.body) {
+		candidates := linkedFeeds(page.url, page.body)
+		if len(candidates) > 0 {
+			return candidates, nil
+		}
+	}
+
+	base, err := url.Parse(page.url)
+	if err != nil {
+		return nil, err
+	}
+	for _, candidateURL := range feedProbeURLs(base) {
+		probeCtx, cancel := context.WithTimeout(ctx, feedProbeTimeout)
+		probe, err := fetcher.fetchDocument(probeCtx, candidateURL)
+		cancel()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if err != nil {
+			continue
+		}
+		if candidate, err := probe.feedCandidate(candidateURL); err == nil {
+			return []FeedCandidate{candidate}, nil
+		}
+	}
+	return nil, ErrNoFeedFound
+}
+
+// feedProbeURLs resolves the common feed paths against the directory of page and then the
+// root of the site
+func feedProbeURLs(page *url.URL) []string {
+	path := page.Path
+	directories := []string{path[:strings.LastIndex(path, "/")+1], "/"}
+
+	var urls []string
+	seen := map[string]bool{}
+	for _, directory := range directories {
+		if !strings.HasPrefix(directory, "/") {
+			directory = "/" + directory
+		}
+		for _, feedPath := range commonFeedPaths {
+			candidateURL := page.ResolveReference(&url.URL{Path: directory + feedPath}).String()
+			if !seen[candidateURL] {
+				seen[candidateURL] = true
+				urls = append(urls, candidateURL)
+			}
+		}
+	}
+	return urls
+}
+
+// fetchDocument downloads url, respecting robots.txt
+func (fetcher *Fetcher) fetchDocument(ctx context.Context, url string) (document, error) {
+	allowed, err := fetcher.robots.allowed(ctx, fetcher, url)
+	if err != nil {
+		return document{}, err
+	}
+	if !allowed {
+		return document{}, ErrBlockedByRobots
+	}
+
+	response, release, err := fetcher.get(ctx, url, nil)
+	if err != nil {
+		return document{}, err
+	}
+	defer release()
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return document{}, fmt.Errorf("unexpected status %s", response.Status)
+	}
+
+	body, err := fetcher.readBody(response)
+	if err != nil {
+		return document{}, err
+	}
+	return document{
+		contentType:  response.Header.Get("Content-Type"),
+		body:         body,
+		url:          response.Request.URL.String(),
+		validators:   responseValidators(response, Validators{}),
+		permanentURL: permanentRedirect(response),
+	}, nil
+}
+
+// mediaType strips the parameters from a content type
+func mediaType(contentType string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return contentType
+	}
+	return mediaType
+}
+
+func isHTML(contentType string, body []byte) bool {
+	if mediaType := mediaType(contentType); mediaType == "text/html" || mediaType == "application/xhtml+xml" {
+		return true
+	}
+	start := bytes.ToLower(bytes.TrimSpace(body[:min(len(body), 512)]))
+	return bytes.HasPrefix(start, []byte("<!doctype html")) || bytes.Contains(start, []byte("<html"))
+}
+
+// linkedFeeds returns the feeds advertised in the head of an HTML page, with their URLs
+// resolved against the page URL or its <base href>
+func linkedFeeds(pageURL string, body []byte) []FeedCandidate {
+	base, err := url.Parse(pageURL)
+	if err != nil {
+		return nil
+	}
+
+	var candidates []FeedCandidate
+	seen := map[string]bool{}
+	tokenizer := html.NewTokenizer(bytes.NewReader(body))
+	for {
+		tokenType := tokenizer.Next()
+		switch tokenType {
+		case html.ErrorToken:
+			return candidates
+		case html.EndTagToken:
+			if name, _ := tokenizer.TagName(); string(name) == "head" {
+				return candidates
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := tokenizer.Token()
+			attributes := map[string]string{}
+			for _, attribute := range token.Attr {
+				attributes[strings.ToLower(attribute.Key)] = strings.TrimSpace(attribute.Val)
+			}
+
+			switch token.Data {
+			case "body":
+				return candidates
+			case "base":
+				if href, err := base.Parse(attributes["href"]); err == nil && attributes["href"] != "" {
+					base = href
+				}
+			case "link":
+				mediaType := strings.ToLower(attributes["type"])
+				if !isAlternate(attributes["rel"]) || !feedMediaTypes[mediaType] || attributes["href"] == "" {
+					continue
+				}
+				href, err := base.Parse(attributes["href"])
+				if err != nil || seen[href.String()] {
+					continue
+				}
+				seen[href.String()] = true
+				candidates = append(candidates, FeedCandidate{
+					Url:   href.String(),
+					Title: attributes["title"],
+					Type:  mediaType,
+				})
+			}
+		}
+	}
+}
+
+func isAlternate(rel string) bool {
+	for _, value := range strings.Fields(strings.ToLower(rel)) {
+		if value == "alternate" {
+			return true
+		}
+	}
+	return false
+}
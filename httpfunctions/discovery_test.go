@@ -0,0 +1,74 @@
+package httpfunctions
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestFeedProbeURLs(t *testing.T) {
+	tests := []struct {
+		name string
+		page string
+		want []string
+	}{
+		{"root", "https://example.com/", []string{
+			"https://example.com/feed", "https://example.com/rss.xml", "https://example.com/atom.xml", "https://example.com/index.xml",
+		}},
+		{"no path", "https://example.com", []string{
+			"https://example.com/feed", "https://example.com/rss.xml", "https://example.com/atom.xml", "https://example.com/index.xml",
+		}},
+		{"page directory then root", "https://example.com/blog/post.html?page=2", []string{
+			"https://example.com/blog/feed", "https://example.com/blog/rss.xml", "https://example.com/blog/atom.xml", "https://example.com/blog/index.xml",
+			"https://example.com/feed", "https://example.com/rss.xml", "https://example.com/atom.xml", "https://example.com/index.xml",
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			page, err := url.Parse(test.page)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := feedProbeURLs(page); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("feedProbeURLs(%q) = %q, want %q", test.page, got, test.want)
+			}
+		})
+	}
+}
+
+func TestLinkedFeeds(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []FeedCandidate
+	}{
+		{"no feeds", `<html><head><title>Blog</title></head></html>`, nil},
+		{"relative and absolute links", `<html><head>
+			<link rel="stylesheet" type="text/css" href="/style.css">
+			<link rel="alternate" type="application/rss+xml" title="Posts" href="feed.xml">
+			<link rel="Alternate" type="Application/Atom+XML" href="https://feeds.example.org/atom">
+			<link rel="alternate" type="text/html" hreflang="fr" href="/fr/">
+		</head></html>`, []FeedCandidate{
+			{Url: "https://example.com/blog/feed.xml", Title: "Posts", Type: "application/rss+xml"},
+			{Url: "https://feeds.example.org/atom", Type: "application/atom+xml"},
+		}},
+		{"base href", `<head><base href="https://cdn.example.com/"><link rel="alternate" type="application/feed+json" href="feed.json"/></head>`, []FeedCandidate{
+			{Url: "https://cdn.example.com/feed.json", Type: "application/feed+json"},
+		}},
+		{"duplicates and empty hrefs skipped", `<head>
+			<link rel="alternate" type="application/rss+xml" href="">
+			<link rel="alternate" type="application/rss+xml" href="/blog/feed.xml">
+			<link rel="alternate home" type="application/rss+xml" href="feed.xml">
+		</head>`, []FeedCandidate{
+			{Url: "https://example.com/blog/feed.xml", Type: "application/rss+xml"},
+		}},
+		{"links in the body ignored", `<html><head></head><body><link rel="alternate" type="application/rss+xml" href="/feed"></body></html>`, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := linkedFeeds("https://example.com/blog/index.html", []byte(test.body)); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("linkedFeeds() = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,250 @@
+package httpfunctions
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/andybalholm/brotli"
+)
+
+// DefaultUserAgent identifies the scraper to the hosts we fetch from and in robots.txt
+const DefaultUserAgent = "blog-aggregator/1.0 (+https://github.com/DreamyMemories/blog-aggregator)"
+
+// ErrNotModified is returned by UrlToFeed when the server answers a conditional request with 304
+var ErrNotModified = errors.New("feed not modified")
+
+// ErrFeedGone is returned by UrlToFeed when the server answers 410, the feed will never come back
+var ErrFeedGone = errors.New("feed is gone (410)")
+
+// ErrBodyTooLarge is returned when a response is larger than the fetcher's MaxBodySize
+var ErrBodyTooLarge = errors.New("response body too large")
+
+// Validators are the HTTP cache validators remembered from the previous fetch of a feed
+type Validators struct {
+	ETag         string
+	LastModified string
+}
+
+// FetchResult is a fetched feed along with what we learned about its location and caching
+type FetchResult struct {
+	Feed       ParsedFeed
+	Validators Validators
+	// PermanentURL is set when every redirect on the way to the feed was permanent
+	PermanentURL string
+}
+
+// FetcherConfig controls how feeds are downloaded, zero values fall back to the defaults
+// except for MaxRedirects
+type FetcherConfig struct {
+	// UserAgent is sent with every request and matched against robots.txt
+	UserAgent string
+	// Timeout bounds a whole request, including reading the body
+	Timeout time.Duration
+	// MaxBodySize is the largest decoded body in bytes we accept
+	MaxBodySize int64
+	// MaxRedirects is how many redirects are followed before giving up, 0 follows none and
+	// a negative value uses the default
+	MaxRedirects int
+}
+
+// Fetcher downloads feeds over one shared HTTP client, so connections are reused across
+// feeds, and keeps the robots.txt cache and per host limits for the scraper
+type Fetcher struct {
+	client      *http.Client
+	userAgent   string
+	maxBodySize int64
+	robots      *robotsCache
+	hosts       *hostLimiter
+}
+
+// NewFetcher creates a Fetcher, proxies are taken from HTTP_PROXY, HTTPS_PROXY and NO_PROXY
+func NewFetcher(config FetcherConfig) *Fetcher {
+	if config.UserAgent == "" {
+		config.UserAgent = DefaultUserAgent
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 10 * time.Second
+	}
+	if config.MaxBodySize <= 0 {
+		config.MaxBodySize = 10 << 20
+	}
+	if config.MaxRedirects < 0 {
+		config.MaxRedirects = 5
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyFromEnvironment
+	transport.MaxIdleConnsPerHost = maxConnectionsPerHost
+	// We ask for brotli as well as gzip, so decoding is done in readBody
+	transport.DisableCompression = true
+
+	return &Fetcher{
+		client: &http.Client{
+			Timeout:   config.Timeout,
+			Transport: transport,
+			CheckRedirect: func(request *http.Request, via []*http.Request) error {
+				// The redirect itself is then the response, and reported as an unexpected status
+				if config.MaxRedirects == 0 {
+					return http.ErrUseLastResponse
+				}
+				if len(via) > config.MaxRedirects {
+					return fmt.Errorf("stopped after %v redirects", config.MaxRedirects)
+				}
+				return nil
+			},
+		},
+		userAgent:   config.UserAgent,
+		maxBodySize: config.MaxBodySize,
+		robots:      &robotsCache{entries: map[string]robotsEntry{}},
+		hosts:       &hostLimiter{hosts: map[string]*hostState{}},
+	}
+}
+
+// get sends a GET request through the host limiter, the caller must close the body
+func (fetcher *Fetcher) get(ctx context.Context, url string, header http.Header) (*http.Response, func(), error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	for key, values := range header {
+		request.Header[key] = values
+	}
+	request.Header.Set("User-Agent", fetcher.userAgent)
+	request.Header.Set("Accept-Encoding", "gzip, br, deflate")
+
+	host := strings.ToLower(request.URL.Hostname())
+	release, err := fetcher.hosts.acquire(ctx, host)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	response, err := fetcher.client.Do(request)
+	if err != nil {
+		release()
+		return nil, nil, err
+	}
+	return response, release, nil
+}
+
+// UrlToFeed fetches and parses the feed at url. ErrNotModified still comes with a result,
+// holding the validators and any permanent redirect
+func (fetcher *Fetcher) UrlToFeed(ctx context.Context, url string, validators Validators) (FetchResult, error) {
+	result := FetchResult{Validators: validators}
+	header := http.Header{}
+	if validators.ETag != "" {
+		header.Set("If-None-Match", validators.ETag)
+	}
+	if validators.LastModified != "" {
+		header.Set("If-Modified-Since", validators.LastModified)
+	}
+
+	allowed, err := fetcher.robots.allowed(ctx, fetcher, url)
+	if err != nil {
+		return result, err
+	}
+	if !allowed {
+		return result, ErrBlockedByRobots
+	}
+
+	response, release, err := fetcher.get(ctx, url, header)
+	if err != nil {
+		return result, err
+	}
+	defer release()
+	defer response.Body.Close()
+	result.PermanentURL = permanentRedirect(response)
+
+	switch response.StatusCode {
+	case http.StatusOK:
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		host := strings.ToLower(response.Request.URL.Hostname())
+		until := fetcher.hosts.backOff(host, response)
+		return result, &RetryLaterError{Host: host, Until: until}
+	case http.StatusNotModified:
+		// A 304 may carry updated validators, otherwise the old ones still apply
+		result.Validators = responseValidators(response, validators)
+		return result, ErrNotModified
+	case http.StatusGone:
+		return result, ErrFeedGone
+	default:
+		return result, fmt.Errorf("unexpected status %s", response.Status)
+	}
+
+	body, err := fetcher.readBody(response)
+	if err != nil {
+		return result, err
+	}
+	result.Feed, err = parseFeed(response.Header.Get("Content-Type"), body)
+	if err != nil {
+		return result, err
+	}
+	result.Validators = responseValidators(response, Validators{})
+	return result, nil
+}
+
+// permanentRedirect walks back the redirects that led to response and returns the final
+// URL if all of them were permanent, a single temporary hop means the old URL stays valid
+func permanentRedirect(response *http.Response) string {
+	request := response.Request
+	if request.Response == nil {
+		return ""
+	}
+	for hop := request.Response; hop != nil; hop = hop.Request.Response {
+		if hop.StatusCode != http.StatusMovedPermanently && hop.StatusCode != http.StatusPermanentRedirect {
+			return ""
+		}
+	}
+	return request.URL.String()
+}
+
+// readBody decodes the response according to its Content-Encoding, failing once the decoded
+// body exceeds maxBodySize so a huge or maliciously compressed feed cannot exhaust memory
+func (fetcher *Fetcher) readBody(response *http.Response) ([]byte, error) {
+	var reader io.Reader = response.Body
+	switch strings.ToLower(strings.TrimSpace(response.Header.Get("Content-Encoding"))) {
+	case "gzip", "x-gzip":
+		gzipReader, err := gzip.NewReader(response.Body)
+		if err != nil {
+			return nil, err
+		}
+		defer gzipReader.Close()
+		reader = gzipReader
+	case "br":
+		reader = brotli.NewReader(response.Body)
+	case "deflate":
+		zlibReader, err := zlib.NewReader(response.Body)
+		if err != nil {
+			return nil, err
+		}
+		defer zlibReader.Close()
+		reader = zlibReader
+	}
+
+	body, err := io.ReadAll(io.LimitReader(reader, fetcher.maxBodySize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > fetcher.maxBodySize {
+		return nil, ErrBodyTooLarge
+	}
+	return body, nil
+}
+
+// responseValidators reads the validators of a response, keeping fallback for any that are missing
+func responseValidators(response *http.Response, fallback Validators) Validators {
+	validators := fallback
+	if etag := response.Header.Get("ETag"); etag != "" {
+		validators.ETag = etag
+	}
+	if lastModified := response.Header.Get("Last-Modified"); lastModified != "" {
+		validators.LastModified = lastModified
+	}
+	return validators
+}
@@ -0,0 +1,170 @@
+package httpfunctions
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// maxConnectionsPerHost caps concurrent requests to one hostname
+	maxConnectionsPerHost = 2
+	// requestsPerSecondPerHost caps the rate of requests to one hostname
+	requestsPerSecondPerHost = 1
+	// maxHostWait is the longest a fetch waits for a host that asked us to back off or for
+	// a free connection to it, past that the feed is rescheduled instead
+	maxHostWait = 30 * time.Second
+	// defaultRetryAfter is used when a 429 or 503 comes without a usable Retry-After
+	defaultRetryAfter = time.Minute
+	// maxRetryAfter caps Retry-After, so a host cannot park its feeds indefinitely
+	maxRetryAfter = 24 * time.Hour
+	// hostPruneInterval is how often hosts no fetch is using are forgotten
+	hostPruneInterval = 10 * time.Minute
+)
+
+// RetryLaterError is returned when a host asked us to slow down. The feed is not failing
+// and should be fetched again after Until
+type RetryLaterError struct {
+	Host  string
+	Until time.Time
+}
+
+func (err *RetryLaterError) Error() string {
+	return fmt.Sprintf("%s asked to retry after %s", err.Host, err.Until.Format(time.RFC3339))
+}
+
+// hostLimiter keeps the scraper polite to hosts serving many of our feeds
+type hostLimiter struct {
+	mu        sync.Mutex
+	hosts     map[string]*hostState
+	lastPrune time.Time
+}
+
+type hostState struct {
+	slots chan struct{}
+	// users counts the fetches holding on to the state, only unused states are pruned
+	users int
+	// nextRequest is the earliest time the next request may start
+	nextRequest time.Time
+	// blockedUntil is set from Retry-After
+	blockedUntil time.Time
+}
+
+// state returns the state of host, done must be called once the caller no longer uses it
+func (limiter *hostLimiter) state(host string) *hostState {
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+	if now := time.Now(); now.Sub(limiter.lastPrune) > hostPruneInterval {
+		limiter.prune(now)
+		limiter.lastPrune = now
+	}
+	state, ok := limiter.hosts[host]
+	if !ok {
+		state = &hostState{slots: make(chan struct{}, maxConnectionsPerHost)}
+		limiter.hosts[host] = state
+	}
+	state.users++
+	return state
+}
+
+func (limiter *hostLimiter) done(state *hostState) {
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+	state.users--
+}
+
+// prune forgets hosts that nobody is fetching from and that no longer hold back the next
+// request, so the map does not keep every host ever fetched. limiter.mu must be held
+func (limiter *hostLimiter) prune(now time.Time) {
+	for host, state := range limiter.hosts {
+		if state.users == 0 && !state.nextRequest.After(now) && !state.blockedUntil.After(now) {
+			delete(limiter.hosts, host)
+		}
+	}
+}
+
+// acquire waits for a free connection and rate limit slot on host, the returned function
+// must be called once the request is done
+func (limiter *hostLimiter) acquire(ctx context.Context, host string) (func(), error) {
+	state := limiter.state(host)
+
+	limiter.mu.Lock()
+	blockedUntil := state.blockedUntil
+	limiter.mu.Unlock()
+	if time.Until(blockedUntil) > maxHostWait {
+		limiter.done(state)
+		return nil, &RetryLaterError{Host: host, Until: blockedUntil}
+	}
+
+	// Give up on a busy host rather than hold a worker that feeds of other hosts need
+	wait := time.NewTimer(maxHostWait)
+	defer wait.Stop()
+	select {
+	case state.slots <- struct{}{}:
+	case <-wait.C:
+		limiter.done(state)
+		return nil, &RetryLaterError{Host: host, Until: time.Now().Add(maxHostWait)}
+	case <-ctx.Done():
+		limiter.done(state)
+		return nil, ctx.Err()
+	}
+	release := func() {
+		<-state.slots
+		limiter.done(state)
+	}
+
+	// Reserve the next request slot, then sleep until it comes
+	limiter.mu.Lock()
+	start := time.Now()
+	if state.nextRequest.After(start) {
+		start = state.nextRequest
+	}
+	if state.blockedUntil.After(start) {
+		start = state.blockedUntil
+	}
+	state.nextRequest = start.Add(time.Second / requestsPerSecondPerHost)
+	limiter.mu.Unlock()
+
+	timer := time.NewTimer(time.Until(start))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return release, nil
+	case <-ctx.Done():
+		release()
+		return nil, ctx.Err()
+	}
+}
+
+// backOff blocks host until the time given by the response's Retry-After header
+func (limiter *hostLimiter) backOff(host string, response *http.Response) time.Time {
+	until := time.Now().Add(retryAfter(response.Header.Get("Retry-After")))
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+	state := limiter.hosts[host]
+	if state != nil && until.After(state.blockedUntil) {
+		state.blockedUntil = until
+	}
+	return until
+}
+
+// retryAfter parses Retry-After, which is either a number of seconds or an HTTP date,
+// capped at maxRetryAfter
+func retryAfter(value string) time.Duration {
+	value = strings.TrimSpace(value)
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		// Compare in seconds, a huge value would overflow a Duration
+		if seconds > int(maxRetryAfter/time.Second) {
+			return maxRetryAfter
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil && date.After(time.Now()) {
+		return min(time.Until(date), maxRetryAfter)
+	}
+	return defaultRetryAfter
+}
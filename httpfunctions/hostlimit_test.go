@@ -0,0 +1,122 @@
+package httpfunctions
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  time.Duration
+	}{
+		{"seconds", "120", 2 * time.Minute},
+		{"seconds with spaces", " 0 ", 0},
+		{"missing", "", defaultRetryAfter},
+		{"negative", "-5", defaultRetryAfter},
+		{"garbage", "soon", defaultRetryAfter},
+		{"seconds capped", "172800", maxRetryAfter},
+		{"seconds that would overflow", "99999999999999", maxRetryAfter},
+		{"date in the past", time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat), defaultRetryAfter},
+		{"date capped", time.Now().Add(72 * time.Hour).UTC().Format(http.TimeFormat), maxRetryAfter},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := retryAfter(test.value); got != test.want {
+				t.Errorf("retryAfter(%q) = %v, want %v", test.value, got, test.want)
+			}
+		})
+	}
+}
+
+func TestRetryAfterDate(t *testing.T) {
+	// HTTP dates have whole seconds, so allow for the truncation
+	got := retryAfter(time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))
+	if got <= time.Hour-2*time.Second || got > time.Hour {
+		t.Errorf("retryAfter(date in an hour) = %v, want about an hour", got)
+	}
+}
+
+func TestHostLimiterRate(t *testing.T) {
+	limiter := &hostLimiter{hosts: map[string]*hostState{}}
+	start := time.Now()
+	release, err := limiter.acquire(context.Background(), "a.example.com")
+	if err != nil {
+		t.Fatalf("acquire returned error: %v", err)
+	}
+	defer release()
+
+	// The next request to the same host is reserved a second later, other hosts are not held up
+	if next := limiter.hosts["a.example.com"].nextRequest; next.Sub(start) < time.Second/requestsPerSecondPerHost {
+		t.Errorf("nextRequest = %v after start, want at least %v", next.Sub(start), time.Second/requestsPerSecondPerHost)
+	}
+	releaseOther, err := limiter.acquire(context.Background(), "b.example.com")
+	if err != nil {
+		t.Fatalf("acquire returned error: %v", err)
+	}
+	releaseOther()
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("acquiring another host took %v, want no wait", elapsed)
+	}
+}
+
+func TestHostLimiterSlots(t *testing.T) {
+	limiter := &hostLimiter{hosts: map[string]*hostState{}}
+	state := limiter.state("a.example.com")
+	for i := 0; i < maxConnectionsPerHost; i++ {
+		state.slots <- struct{}{}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := limiter.acquire(ctx, "a.example.com"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("acquire on a busy host = %v, want to wait for a free connection", err)
+	}
+	if state.users != 1 {
+		t.Errorf("users = %v after a cancelled acquire, want 1", state.users)
+	}
+}
+
+func TestHostLimiterBackOff(t *testing.T) {
+	limiter := &hostLimiter{hosts: map[string]*hostState{}}
+	release, err := limiter.acquire(context.Background(), "a.example.com")
+	if err != nil {
+		t.Fatalf("acquire returned error: %v", err)
+	}
+	until := limiter.backOff("a.example.com", &http.Response{Header: http.Header{"Retry-After": {"120"}}})
+	release()
+
+	_, err = limiter.acquire(context.Background(), "a.example.com")
+	var retryLater *RetryLaterError
+	if !errors.As(err, &retryLater) || !retryLater.Until.Equal(until) {
+		t.Errorf("acquire on a blocked host = %v, want to retry at %v", err, until)
+	}
+}
+
+func TestHostLimiterPrune(t *testing.T) {
+	limiter := &hostLimiter{hosts: map[string]*hostState{}}
+	for _, host := range []string{"idle.example.com", "blocked.example.com"} {
+		release, err := limiter.acquire(context.Background(), host)
+		if err != nil {
+			t.Fatalf("acquire returned error: %v", err)
+		}
+		release()
+	}
+	limiter.backOff("blocked.example.com", &http.Response{Header: http.Header{"Retry-After": {"120"}}})
+	busy := limiter.state("busy.example.com")
+
+	limiter.prune(time.Now().Add(2 * time.Second))
+	if _, ok := limiter.hosts["idle.example.com"]; ok {
+		t.Error("idle host was kept")
+	}
+	if _, ok := limiter.hosts["blocked.example.com"]; !ok {
+		t.Error("host still backing off was pruned")
+	}
+	if limiter.hosts["busy.example.com"] != busy {
+		t.Error("host in use was pruned")
+	}
+}
@@ -2,19 +2,55 @@ package httpfunctions
 
 import (
 	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"html"
+	"log"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/DreamyMemories/blog-aggregator/internal/database"
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
+	"github.com/lib/pq"
 )
 
+// maxFeedUrlLength and maxFeedNameLength are the longest url and name the feeds table stores
+const (
+	maxFeedUrlLength  = 255
+	maxFeedNameLength = 255
+)
+
+// uniqueViolation is the Postgres error code of a unique constraint violation
+const uniqueViolation = "23505"
+
+// errFeedUrlTooLong is returned by createFeed for a url the feeds table cannot store
+var errFeedUrlTooLong = fmt.Errorf("feed url is longer than %v characters", maxFeedUrlLength)
+
 type ApiConfig struct {
-	DB *database.Queries
+	// Conn is the connection pool behind DB, for queries that must run in a transaction
+	Conn    *sql.DB
+	DB      *database.Queries
+	Fetcher *Fetcher
+}
+
+// inTx runs fn with queries bound to a single transaction, which is committed when fn succeeds
+func inTx(ctx context.Context, conn *sql.DB, db *database.Queries, fn func(*database.Queries) error) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	err = fn(db.WithTx(tx))
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
 func Mux(apiConfig *ApiConfig) *mux.Router {
@@ -23,10 +59,17 @@ func Mux(apiConfig *ApiConfig) *mux.Router {
 	mux.Handle("/v1/err", corsMiddleware(http.HandlerFunc(handlerError)))
 	mux.Handle("/v1/users", corsMiddleware(apiConfig.middlewareAuth(apiConfig.handlerUser)))
 	mux.Handle("/v1/feeds", corsMiddleware(apiConfig.middlewareAuth(apiConfig.handlerFeed)))
+	mux.Handle("/v1/opml", corsMiddleware(apiConfig.middlewareAuth(apiConfig.handlerOPML)))
 	mux.Handle("/v1/allfeeds", corsMiddleware(apiConfig.handlerGetAllFeed()))
 	mux.Handle("/v1/feed_follows", corsMiddleware(apiConfig.middlewareAuth(apiConfig.handlerCreateFeedFollow)))
+	mux.Handle("/v1/feed_follows/unread", corsMiddleware(apiConfig.middlewareAuth(apiConfig.handlerGetUnreadCounts))).Methods("GET")
 	mux.Handle("/v1/feed_follows/{feedFollowID}", corsMiddleware(apiConfig.middlewareAuth(apiConfig.handlerDeleteFeedFollow))).Methods("DELETE")
-	mux.Handle("/v1/posts/{limit}", corsMiddleware(apiConfig.middlewareAuth(apiConfig.handlerGetPostsByUser))).Methods("GET")
+	mux.Handle("/v1/posts", corsMiddleware(apiConfig.middlewareAuth(apiConfig.handlerGetPostsByUser))).Methods("GET")
+	mux.Handle("/v1/posts/read", corsMiddleware(apiConfig.middlewareAuth(apiConfig.handlerMarkPostsRead))).Methods("POST")
+	mux.Handle("/v1/posts/unread", corsMiddleware(apiConfig.middlewareAuth(apiConfig.handlerMarkPostsUnread))).Methods("POST")
+	mux.Handle("/v1/posts/read_all", corsMiddleware(apiConfig.middlewareAuth(apiConfig.handlerMarkAllPostsRead))).Methods("POST")
+	mux.Handle("/v1/posts/{postID}/read", corsMiddleware(apiConfig.middlewareAuth(apiConfig.handlerMarkPostRead))).Methods("POST", "DELETE")
+	mux.Handle("/v1/posts/search", corsMiddleware(apiConfig.middlewareAuth(apiConfig.handlerSearchPosts))).Methods("GET")
 	return mux
 }
 
@@ -40,7 +83,7 @@ func handlerError(w http.ResponseWriter, r *http.Request) {
 
 func (apiConfig *ApiConfig) handlerUser(w http.ResponseWriter, r *http.Request, user database.User) {
 	if r.Method == http.MethodPost {
-		ctx := context.Background()
+		ctx := r.Context()
 		var name struct {
 			Name string `json:"name"`
 		}
@@ -71,69 +114,280 @@ func (apiConfig *ApiConfig) handlerUser(w http.ResponseWriter, r *http.Request,
 }
 
 func (apiConfig *ApiConfig) handlerFeed(w http.ResponseWriter, r *http.Request, user database.User) {
-	ctx := context.Background()
+	ctx := r.Context()
 	if r.Method == http.MethodPost {
 		var body struct {
 			Name string `json:"name"`
 			Url  string `json:"url"`
 		}
 		err := json.NewDecoder(r.Body).Decode(&body)
-		if err != nil || body.Name == "" || body.Url == "" {
+		if err != nil || body.Url == "" {
 			respondWithError(w, http.StatusBadRequest, "Invalid request body")
 			return
 		}
+		if utf8.RuneCountInString(body.Url) > maxFeedUrlLength {
+			respondWithError(w, http.StatusBadRequest, errFeedUrlTooLong.Error())
+			return
+		}
 
-		newFeed := database.CreateFeedParams{
-			ID:        uuid.New(),
-			CreatedAt: time.Now(),
-			UpdatedAt: time.Now(),
-			Name:      body.Name,
-			Url:       body.Url,
-			UserID:    user.ID,
+		// A feed someone already added is followed without fetching it again
+		feed, err := apiConfig.storedFeed(ctx, body.Url)
+		if err == nil {
+			apiConfig.followStoredFeed(w, r, user, feed)
+			return
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusInternalServerError, "Failed to look up feed "+err.Error())
+			return
+		}
+
+		// Users often submit a website rather than its feed, so look for the feed behind it
+		candidates, err := apiConfig.Fetcher.DiscoverFeeds(ctx, body.Url)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Could not find a feed at "+body.Url+": "+err.Error())
+			return
+		}
+		if len(candidates) > 1 {
+			respondWithJson(w, http.StatusMultipleChoices, struct {
+				Error      string          `json:"error"`
+				Candidates []FeedCandidate `json:"candidates"`
+			}{
+				Error:      "Several feeds found, submit one of the candidate urls",
+				Candidates: candidates,
+			})
+			return
+		}
+		candidate := candidates[0]
+
+		// Fetch the feed the way the scraper will, so broken feeds are never stored. A feed
+		// found without following a link was fetched already
+		var result FetchResult
+		if candidate.result != nil {
+			result = *candidate.result
+		} else {
+			result, err = apiConfig.Fetcher.UrlToFeed(ctx, candidate.Url, Validators{})
+			if err != nil {
+				respondWithError(w, http.StatusBadRequest, "Could not fetch feed: "+err.Error())
+				return
+			}
+		}
+
+		// The feed may be stored under the url it was discovered at or the one it moved to
+		feed, err = apiConfig.storedFeed(ctx, candidate.Url, result.PermanentURL)
+		if errors.Is(err, sql.ErrNoRows) {
+			var feedFollow database.FeedFollow
+			feed, feedFollow, err = apiConfig.createFeed(ctx, user, body.Name, candidate.Url, result, "", "")
+			if err == nil {
+				respondWithFeedFollow(w, feed, feedFollow)
+				return
+			}
+			if errors.Is(err, errFeedUrlTooLong) {
+				respondWithError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			// Someone else may have added the same feed meanwhile
+			log.Println("Something went wrong in creating the feed", err.Error())
+			feed, err = apiConfig.storedFeed(ctx, feedUrl(candidate.Url, result))
+		}
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Failed to create feed "+err.Error())
+			return
 		}
+		apiConfig.followStoredFeed(w, r, user, feed)
+	}
+}
 
-		newFeedFollow := database.CreateFeedFollowParams{
+// storedFeed returns the feed stored under the first of urls that has one, sql.ErrNoRows when none does
+func (apiConfig *ApiConfig) storedFeed(ctx context.Context, urls ...string) (database.Feed, error) {
+	for _, url := range urls {
+		if url == "" {
+			continue
+		}
+		feed, err := apiConfig.DB.GetFeedByUrl(ctx, url)
+		if !errors.Is(err, sql.ErrNoRows) {
+			return feed, err
+		}
+	}
+	return database.Feed{}, sql.ErrNoRows
+}
+
+// followStoredFeed follows a feed that was added before, answering 409 when the user already does
+func (apiConfig *ApiConfig) followStoredFeed(w http.ResponseWriter, r *http.Request, user database.User, feed database.Feed) {
+	feedFollow, err := apiConfig.DB.CreateFeedFollow(r.Context(), database.CreateFeedFollowParams{
+		ID:        uuid.New(),
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+		FeedID:    feed.ID,
+		UserID:    user.ID,
+	})
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+		respondWithError(w, http.StatusConflict, "Already following this feed")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to create feed follow "+err.Error())
+		return
+	}
+	respondWithFeedFollow(w, feed, feedFollow)
+}
+
+func respondWithFeedFollow(w http.ResponseWriter, feed database.Feed, feedFollow database.FeedFollow) {
+	response := struct {
+		Feed        interface{} `json:"feed"`
+		Feed_follow interface{} `json:"feed_follow"`
+	}{
+		Feed:        publicFeed(feed),
+		Feed_follow: feedFollow,
+	}
+	respondWithJson(w, 200, response)
+}
+
+// feedUrl is the url a fetched feed is stored under, the one it permanently moved to if any
+func feedUrl(url string, result FetchResult) string {
+	if result.PermanentURL != "" {
+		return result.PermanentURL
+	}
+	return url
+}
+
+// createFeed stores a feed that was just fetched from url, follows it for user with the given
+// category and title and ingests its first batch of posts. It all happens in one transaction,
+// so a failure leaves no feed without followers behind. The name defaults to the feed's title
+// and is cut to fit the feeds table
+func (apiConfig *ApiConfig) createFeed(ctx context.Context, user database.User, name string, url string, result FetchResult, category string, title string) (database.Feed, database.FeedFollow, error) {
+	url = feedUrl(url, result)
+	result.PermanentURL = ""
+	if utf8.RuneCountInString(url) > maxFeedUrlLength {
+		return database.Feed{}, database.FeedFollow{}, errFeedUrlTooLong
+	}
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = strings.TrimSpace(result.Feed.Title)
+	}
+	if name == "" {
+		name = url
+	}
+	name = truncate(name, maxFeedNameLength)
+
+	var feed database.Feed
+	var feedFollow database.FeedFollow
+	newPosts := 0
+	err := inTx(ctx, apiConfig.Conn, apiConfig.DB, func(tx *database.Queries) error {
+		created, err := tx.CreateFeed(ctx, database.CreateFeedParams{
+			ID:          uuid.New(),
+			CreatedAt:   time.Now(),
+			UpdatedAt:   time.Now(),
+			Name:        name,
+			Url:         url,
+			UserID:      user.ID,
+			Description: toNullString(strings.TrimSpace(result.Feed.Description)),
+			SiteUrl:     toNullString(strings.TrimSpace(result.Feed.Link)),
+			Language:    toNullString(strings.TrimSpace(result.Feed.Language)),
+		})
+		if err != nil {
+			return err
+		}
+		feed, err = markFeedFetched(ctx, tx, created, result, false)
+		if err != nil {
+			return err
+		}
+		feedFollow, err = tx.CreateFeedFollow(ctx, database.CreateFeedFollowParams{
 			ID:        uuid.New(),
 			CreatedAt: time.Now(),
 			UpdatedAt: time.Now(),
-			FeedID:    newFeed.ID,
+			FeedID:    feed.ID,
 			UserID:    user.ID,
+			Category:  toNullString(category),
+			Title:     toNullString(title),
+		})
+		if err != nil {
+			return err
 		}
+		// Ingest the first batch right away so the user sees content immediately. A post that
+		// fails to store aborts the transaction, which then fails to commit
+		newPosts, _ = storePosts(ctx, tx, feed, result.Feed)
+		return nil
+	})
+	if err != nil {
+		return database.Feed{}, database.FeedFollow{}, err
+	}
+	log.Printf("New feed created: %v with %v posts", feed.Name, newPosts)
+	return feed, feedFollow, nil
+}
 
-		feed, err := apiConfig.DB.CreateFeed(ctx, newFeed)
-		feedFollow, errFeedFollow := apiConfig.DB.CreateFeedFollow(ctx, newFeedFollow)
-		if err != nil || errFeedFollow != nil {
-			respondWithError(w, http.StatusInternalServerError, "Failed to create feed"+err.Error())
-			return
-		}
-		fmt.Printf("New feed created: %v\n", feed)
-		response := struct {
-			Feed        interface{} `json:"feed"`
-			Feed_follow interface{} `json:"feed_follow"`
-		}{
-			Feed:        feed,
-			Feed_follow: feedFollow,
-		}
-		respondWithJson(w, 200, response)
+// PublicFeed is a feed as listed to anyone, without the scraper's lease and validators
+type PublicFeed struct {
+	ID                  uuid.UUID
+	CreatedAt           time.Time
+	UpdatedAt           time.Time
+	Name                string
+	Url                 string
+	UserID              uuid.UUID
+	Description         sql.NullString
+	SiteUrl             sql.NullString
+	Language            sql.NullString
+	LastFetchedAt       sql.NullTime
+	NextFetchAt         time.Time
+	LastError           sql.NullString
+	LastErrorAt         sql.NullTime
+	ConsecutiveFailures int32
+	DisabledAt          sql.NullTime
+}
+
+func publicFeed(feed database.Feed) PublicFeed {
+	return PublicFeed{
+		ID:                  feed.ID,
+		CreatedAt:           feed.CreatedAt,
+		UpdatedAt:           feed.UpdatedAt,
+		Name:                feed.Name,
+		Url:                 feed.Url,
+		UserID:              feed.UserID,
+		Description:         feed.Description,
+		SiteUrl:             feed.SiteUrl,
+		Language:            feed.Language,
+		LastFetchedAt:       feed.LastFetchedAt,
+		NextFetchAt:         feed.NextFetchAt,
+		LastError:           feed.LastError,
+		LastErrorAt:         feed.LastErrorAt,
+		ConsecutiveFailures: feed.ConsecutiveFailures,
+		DisabledAt:          feed.DisabledAt,
 	}
 }
 
 func (apiConfig *ApiConfig) handlerGetAllFeed() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method == "GET" {
-			ctx := context.Background()
-			feeds, err := apiConfig.DB.GetAllFeed(ctx)
+			ctx := r.Context()
+			page, err := parsePageRequest(r)
+			if err != nil {
+				respondWithError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			feeds, err := apiConfig.DB.GetAllFeed(ctx, database.GetAllFeedParams{
+				CursorCreatedAt: page.cursorTime(),
+				CursorID:        page.cursorID(),
+				PageSize:        page.pageSize(),
+			})
 			if err != nil {
 				respondWithError(w, http.StatusInternalServerError, "Failed to fetch feeds")
 				return
 			}
-			respondWithJson(w, 200, feeds)
+			feedsPage := newPage(feeds, page, func(feed database.Feed) pageCursor {
+				return pageCursor{Time: feed.CreatedAt, ID: feed.ID}
+			})
+			items := []PublicFeed{}
+			for _, feed := range feedsPage.Items.([]database.Feed) {
+				items = append(items, publicFeed(feed))
+			}
+			feedsPage.Items = items
+			respondWithJson(w, 200, feedsPage)
 		}
 	}
 }
 
 func (apiConfig *ApiConfig) handlerCreateFeedFollow(w http.ResponseWriter, r *http.Request, user database.User) {
-	ctx := context.Background()
+	ctx := r.Context()
 	if r.Method == "POST" {
 		var body struct {
 			FeedID uuid.UUID `json:"feed_id"`
@@ -159,19 +413,32 @@ func (apiConfig *ApiConfig) handlerCreateFeedFollow(w http.ResponseWriter, r *ht
 
 		respondWithJson(w, http.StatusOK, feed)
 	} else if r.Method == "GET" {
-		feeds, err := apiConfig.DB.GetFeedFollowsByUser(ctx, user.ID)
+		page, err := parsePageRequest(r)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		feeds, err := apiConfig.DB.GetFeedFollowsByUserPage(ctx, database.GetFeedFollowsByUserPageParams{
+			UserID:          user.ID,
+			CursorCreatedAt: page.cursorTime(),
+			CursorID:        page.cursorID(),
+			PageSize:        page.pageSize(),
+		})
 		if err != nil {
 			respondWithError(w, http.StatusBadRequest, "Can't find feeds with given user id")
+			return
 		}
 
-		respondWithJson(w, 200, feeds)
+		respondWithJson(w, 200, newPage(feeds, page, func(feedFollow database.FeedFollow) pageCursor {
+			return pageCursor{Time: feedFollow.CreatedAt, ID: feedFollow.ID}
+		}))
 
 	}
 }
 
 func (apiConfig *ApiConfig) handlerDeleteFeedFollow(w http.ResponseWriter, r *http.Request, user database.User) {
 	parameter := mux.Vars(r)
-	ctx := context.Background()
+	ctx := r.Context()
 	feedFollowID := parameter["feedFollowID"]
 
 	id, err := uuid.Parse(feedFollowID)
@@ -191,24 +458,142 @@ func (apiConfig *ApiConfig) handlerDeleteFeedFollow(w http.ResponseWriter, r *ht
 }
 
 func (apiConfig *ApiConfig) handlerGetPostsByUser(w http.ResponseWriter, r *http.Request, user database.User) {
-	parameter := mux.Vars(r)
-	limit := parameter["limit"]
-	if limit == "" {
-		limit = "10"
+	page, err := parsePageRequest(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
 	}
-	lim, err := strconv.Atoi(limit)
+	filters, err := parsePostFilters(r)
 	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "Could not parse limit")
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
 	}
 
-	posts, err := apiConfig.DB.GetPostsByUser(context.Background(), database.GetPostsByUserParams{
-		UserID: user.ID,
-		Limit:  int32(lim),
+	posts, err := apiConfig.DB.GetPostsByUser(r.Context(), database.GetPostsByUserParams{
+		UserID:            user.ID,
+		CursorPublishedAt: page.cursorTime(),
+		CursorID:          page.cursorID(),
+		FeedIds:           filters.FeedIDs,
+		Since:             filters.Since,
+		Until:             filters.Until,
+		Author:            filters.Author,
+		Category:          filters.Category,
+		UnreadOnly:        filters.UnreadOnly,
+		PageSize:          page.pageSize(),
 	})
 	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "Could not create post"+err.Error())
+		respondWithError(w, http.StatusBadRequest, "Could not fetch posts "+err.Error())
+		return
+	}
+	respondWithJson(w, http.StatusOK, newPage(posts, page, func(post database.GetPostsByUserRow) pageCursor {
+		return pageCursor{Time: post.PublishedAt, ID: post.ID}
+	}))
+}
+
+// handlerSearchPosts searches the posts of followed feeds, best matches first. q takes web
+// search syntax: "quoted phrases", or between alternatives and -word to exclude a word
+func (apiConfig *ApiConfig) handlerSearchPosts(w http.ResponseWriter, r *http.Request, user database.User) {
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query == "" {
+		respondWithError(w, http.StatusBadRequest, "Missing search query q")
+		return
+	}
+	page, err := parsePageRequest(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	posts, err := apiConfig.DB.SearchPostsByUser(r.Context(), database.SearchPostsByUserParams{
+		Query:             query,
+		UserID:            user.ID,
+		CursorRank:        page.cursorRank(),
+		CursorPublishedAt: page.cursorTime(),
+		CursorID:          page.cursorID(),
+		PageSize:          page.pageSize(),
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Could not search posts "+err.Error())
+		return
+	}
+	for i := range posts {
+		posts[i].Snippet = highlightSnippet(posts[i].Snippet)
+	}
+	respondWithJson(w, http.StatusOK, newPage(posts, page, func(post database.SearchPostsByUserRow) pageCursor {
+		return pageCursor{Rank: post.Rank, Time: post.PublishedAt, ID: post.ID}
+	}))
+}
+
+// snippetMarks turns the delimiters around the matches of a search snippet into <mark> tags
+var snippetMarks = strings.NewReplacer("\x02", "<mark>", "\x03", "</mark>")
+
+// highlightSnippet escapes a search snippet, which is text taken from feeds, so the <mark>
+// tags around the matches are the only markup in it. Entities left over from the post's
+// HTML are decoded first so they are not escaped twice
+func highlightSnippet(snippet string) string {
+	return snippetMarks.Replace(html.EscapeString(html.UnescapeString(snippet)))
+}
+
+// postFilters narrows a posts listing, unset filters match every post
+type postFilters struct {
+	FeedIDs    []uuid.UUID
+	Since      sql.NullTime
+	Until      sql.NullTime
+	Author     sql.NullString
+	Category   sql.NullString
+	UnreadOnly bool
+}
+
+// parsePostFilters reads the feed_id, since, until, author, category and unread query parameters.
+// feed_id may be repeated or comma separated, since and until are RFC 3339 times or dates
+func parsePostFilters(r *http.Request) (postFilters, error) {
+	query := r.URL.Query()
+	filters := postFilters{FeedIDs: []uuid.UUID{}}
+	for _, value := range query["feed_id"] {
+		for _, feedID := range strings.Split(value, ",") {
+			id, err := uuid.Parse(strings.TrimSpace(feedID))
+			if err != nil {
+				return postFilters{}, errors.New("invalid feed_id " + feedID)
+			}
+			filters.FeedIDs = append(filters.FeedIDs, id)
+		}
+	}
+
+	var err error
+	filters.Since, err = parseTimeParam(query.Get("since"))
+	if err != nil {
+		return postFilters{}, errors.New("invalid since, use RFC 3339 or YYYY-MM-DD")
+	}
+	filters.Until, err = parseTimeParam(query.Get("until"))
+	if err != nil {
+		return postFilters{}, errors.New("invalid until, use RFC 3339 or YYYY-MM-DD")
+	}
+	if filters.Since.Valid && filters.Until.Valid && !filters.Since.Time.Before(filters.Until.Time) {
+		return postFilters{}, errors.New("since must be before until")
+	}
+
+	filters.Author = toNullString(strings.TrimSpace(query.Get("author")))
+	filters.Category = toNullString(strings.TrimSpace(query.Get("category")))
+	if unread := query.Get("unread"); unread != "" {
+		filters.UnreadOnly, err = strconv.ParseBool(unread)
+		if err != nil {
+			return postFilters{}, errors.New("invalid unread, use true or false")
+		}
+	}
+	return filters, nil
+}
+
+func parseTimeParam(value string) (sql.NullTime, error) {
+	if value == "" {
+		return sql.NullTime{}, nil
+	}
+	for _, layout := range []string{time.RFC3339Nano, time.DateOnly} {
+		t, err := time.Parse(layout, value)
+		if err == nil {
+			return sql.NullTime{Time: t, Valid: true}, nil
+		}
 	}
-	respondWithJson(w, http.StatusOK, posts)
+	return sql.NullTime{}, errors.New("invalid time " + value)
 }
 
 func corsMiddleware(next http.Handler) http.Handler {
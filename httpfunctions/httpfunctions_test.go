@@ -0,0 +1,94 @@
+package httpfunctions
+
+import (
+	"database/sql"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestParsePostFilters(t *testing.T) {
+	first := uuid.MustParse("6f1c2a3e-4b5d-4e6f-8a7b-9c0d1e2f3a4b")
+	second := uuid.MustParse("0a1b2c3d-4e5f-4a6b-8c7d-9e0f1a2b3c4d")
+	tests := []struct {
+		name    string
+		query   string
+		want    postFilters
+		wantErr bool
+	}{
+		{"no filters", "", postFilters{FeedIDs: []uuid.UUID{}}, false},
+		{"comma separated feed ids", "feed_id=" + first.String() + ",%20" + second.String(),
+			postFilters{FeedIDs: []uuid.UUID{first, second}}, false},
+		{"repeated feed ids", "feed_id=" + first.String() + "&feed_id=" + second.String(),
+			postFilters{FeedIDs: []uuid.UUID{first, second}}, false},
+		{"invalid feed id", "feed_id=" + first.String() + ",nope", postFilters{}, true},
+		{"dates", "since=2024-01-01&until=2024-02-01", postFilters{
+			FeedIDs: []uuid.UUID{},
+			Since:   sql.NullTime{Time: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), Valid: true},
+			Until:   sql.NullTime{Time: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC), Valid: true},
+		}, false},
+		{"RFC 3339 times", "since=2024-01-01T10:00:00Z&until=2024-01-01T12:30:00.5%2B02:00", postFilters{
+			FeedIDs: []uuid.UUID{},
+			Since:   sql.NullTime{Time: time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC), Valid: true},
+			Until:   sql.NullTime{Time: time.Date(2024, 1, 1, 10, 30, 0, 500000000, time.UTC), Valid: true},
+		}, false},
+		{"invalid since", "since=yesterday", postFilters{}, true},
+		{"invalid until", "until=2024-13-01", postFilters{}, true},
+		{"since equal to until", "since=2024-01-01&until=2024-01-01T00:00:00Z", postFilters{}, true},
+		{"since after until", "since=2024-02-01&until=2024-01-01", postFilters{}, true},
+		{"author and category", "author=%20Jane%20&category=go", postFilters{
+			FeedIDs:  []uuid.UUID{},
+			Author:   toNullString("Jane"),
+			Category: toNullString("go"),
+		}, false},
+		{"unread", "unread=true", postFilters{FeedIDs: []uuid.UUID{}, UnreadOnly: true}, false},
+		{"unread false", "unread=0", postFilters{FeedIDs: []uuid.UUID{}}, false},
+		{"invalid unread", "unread=yes", postFilters{}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := parsePostFilters(httptest.NewRequest("GET", "/v1/posts?"+test.query, nil))
+			if (err != nil) != test.wantErr {
+				t.Fatalf("parsePostFilters() error = %v, want error %v", err, test.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			// Compare instants, times parsed with an offset keep their location
+			if got.Since.Time.Equal(test.want.Since.Time) {
+				got.Since.Time = test.want.Since.Time
+			}
+			if got.Until.Time.Equal(test.want.Until.Time) {
+				got.Until.Time = test.want.Until.Time
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("parsePostFilters() = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestHighlightSnippet(t *testing.T) {
+	tests := []struct {
+		name    string
+		snippet string
+		want    string
+	}{
+		{"plain text", "nothing to see", "nothing to see"},
+		{"matches marked", "the \x02gopher\x03 and the \x02Gopher\x03", "the <mark>gopher</mark> and the <mark>Gopher</mark>"},
+		{"markup escaped", "<script>alert(1)</script> \x02hi\x03", "&lt;script&gt;alert(1)&lt;/script&gt; <mark>hi</mark>"},
+		{"entities not escaped twice", "Tom &amp; Jerry &lt;3 \x02cats\x03", "Tom &amp; Jerry &lt;3 <mark>cats</mark>"},
+		{"raw ampersand and quotes", `Q&A "quoted" it's`, "Q&amp;A &#34;quoted&#34; it&#39;s"},
+		{"literal mark tags escaped", "<mark>fake</mark>", "&lt;mark&gt;fake&lt;/mark&gt;"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := highlightSnippet(test.snippet); got != test.want {
+				t.Errorf("highlightSnippet(%q) = %q, want %q", test.snippet, got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package httpfunctions
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime"
+)
+
+// JSONFeed follows the JSON Feed 1.1 spec, see https://www.jsonfeed.org/version/1.1/
+type JSONFeed struct {
+	Version     string           `json:"version"`
+	Title       string           `json:"title"`
+	HomePageUrl string           `json:"home_page_url"`
+	Description string           `json:"description"`
+	Language    string           `json:"language"`
+	Authors     []JSONFeedAuthor `json:"authors"`
+	Author      *JSONFeedAuthor  `json:"author"`
+	Items       []JSONFeedItem   `json:"items"`
+}
+
+type JSONFeedItem struct {
+	ID            JSONFeedID       `json:"id"`
+	Url           string           `json:"url"`
+	ExternalUrl   string           `json:"external_url"`
+	Title         string           `json:"title"`
+	ContentHtml   string           `json:"content_html"`
+	ContentText   string           `json:"content_text"`
+	Summary       string           `json:"summary"`
+	DatePublished string           `json:"date_published"`
+	DateModified  string           `json:"date_modified"`
+	Authors       []JSONFeedAuthor `json:"authors"`
+	Author        *JSONFeedAuthor  `json:"author"`
+	Tags          []string         `json:"tags"`
+}
+
+// JSONFeedID is an item id. The spec asks readers to accept ids that are not strings,
+// such as numbers, and use them as strings
+type JSONFeedID string
+
+func (id *JSONFeedID) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if bytes.HasPrefix(data, []byte(`"`)) {
+		var value string
+		err := json.Unmarshal(data, &value)
+		*id = JSONFeedID(value)
+		return err
+	}
+	if bytes.Equal(data, []byte("null")) {
+		*id = ""
+		return nil
+	}
+	// Numbers are kept as written, 123 stays "123" rather than becoming a float
+	*id = JSONFeedID(data)
+	return nil
+}
+
+type JSONFeedAuthor struct {
+	Name string `json:"name"`
+}
+
+func (jsonFeed JSONFeed) toParsedFeed() ParsedFeed {
+	feed := ParsedFeed{
+		Title:       jsonFeed.Title,
+		Link:        jsonFeed.HomePageUrl,
+		Description: jsonFeed.Description,
+		Language:    jsonFeed.Language,
+	}
+	for _, item := range jsonFeed.Items {
+		link := item.Url
+		if link == "" {
+			link = item.ExternalUrl
+		}
+
+		content := item.ContentHtml
+		if content == "" {
+			content = item.ContentText
+		}
+		description := item.Summary
+		if description == "" {
+			description = content
+		}
+
+		pubDate := item.DatePublished
+		if pubDate == "" {
+			pubDate = item.DateModified
+		}
+
+		feed.Items = append(feed.Items, FeedItem{
+			GUID:        string(item.ID),
+			Title:       item.Title,
+			Link:        link,
+			Description: description,
+			Content:     content,
+			PubDate:     pubDate,
+			Author:      jsonFeedAuthor(item.Authors, item.Author, jsonFeed.Authors, jsonFeed.Author),
+			Categories:  item.Tags,
+		})
+	}
+	return feed
+}
+
+// jsonFeedAuthor picks the item's author over the feed's, JSON Feed 1.0 used a single
+// author object where 1.1 uses an authors list
+func jsonFeedAuthor(itemAuthors []JSONFeedAuthor, itemAuthor *JSONFeedAuthor, feedAuthors []JSONFeedAuthor, feedAuthor *JSONFeedAuthor) string {
+	if itemAuthor != nil {
+		itemAuthors = append(itemAuthors, *itemAuthor)
+	}
+	if feedAuthor != nil {
+		feedAuthors = append(feedAuthors, *feedAuthor)
+	}
+	for _, author := range append(itemAuthors, feedAuthors...) {
+		if author.Name != "" {
+			return author.Name
+		}
+	}
+	return ""
+}
+
+// isJSONFeed checks the content type first and falls back to sniffing the body, as XML never starts with {
+func isJSONFeed(contentType string, body []byte) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err == nil && (mediaType == "application/feed+json" || mediaType == "application/json") {
+		return true
+	}
+	trimmed := bytes.TrimSpace(bytes.TrimPrefix(body, []byte("\xef\xbb\xbf")))
+	return bytes.HasPrefix(trimmed, []byte("{"))
+}
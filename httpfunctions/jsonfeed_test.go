@@ -0,0 +1,101 @@
+package httpfunctions
+
+import (
+	"reflect"
+	"testing"
+)
+
+const jsonFeedSample = `{
+  "version": "https://jsonfeed.org/version/1.1",
+  "title": "Example JSON Feed",
+  "home_page_url": "https://example.com/",
+  "description": "Posts as JSON",
+  "language": "en",
+  "authors": [{"name": "Feed Author"}],
+  "items": [
+    {
+      "id": "1",
+      "url": "https://example.com/1",
+      "title": "HTML item",
+      "content_html": "<p>Hello</p>",
+      "summary": "Hello summary",
+      "date_published": "2006-01-02T15:04:05Z",
+      "authors": [{"name": ""}, {"name": "Item Author"}],
+      "tags": ["go", "json"]
+    },
+    {
+      "id": "2",
+      "external_url": "https://elsewhere.example.org/2",
+      "content_text": "Plain text",
+      "date_modified": "2006-01-03T00:00:00Z"
+    },
+    {
+      "id": 3,
+      "url": "https://example.com/3",
+      "content_text": "Version 1.0 author",
+      "author": {"name": "Old Style"}
+    }
+  ]
+}`
+
+func TestParseFeedJSON(t *testing.T) {
+	// The body is sniffed when the server sends a generic content type
+	feed, err := parseFeed("text/plain", []byte("\xef\xbb\xbf"+jsonFeedSample))
+	if err != nil {
+		t.Fatalf("parseFeed returned error: %v", err)
+	}
+
+	if feed.Title != "Example JSON Feed" || feed.Link != "https://example.com/" || feed.Description != "Posts as JSON" || feed.Language != "en" {
+		t.Errorf("feed = %q %q %q %q", feed.Title, feed.Link, feed.Description, feed.Language)
+	}
+
+	want := []FeedItem{
+		{
+			GUID:        "1",
+			Title:       "HTML item",
+			Link:        "https://example.com/1",
+			Description: "Hello summary",
+			Content:     "<p>Hello</p>",
+			PubDate:     "2006-01-02T15:04:05Z",
+			Author:      "Item Author",
+			Categories:  []string{"go", "json"},
+		},
+		{
+			GUID:        "2",
+			Link:        "https://elsewhere.example.org/2",
+			Description: "Plain text",
+			Content:     "Plain text",
+			PubDate:     "2006-01-03T00:00:00Z",
+			Author:      "Feed Author",
+		},
+		{
+			GUID:        "3",
+			Link:        "https://example.com/3",
+			Description: "Version 1.0 author",
+			Content:     "Version 1.0 author",
+			Author:      "Old Style",
+		},
+	}
+	if !reflect.DeepEqual(feed.Items, want) {
+		t.Errorf("Items = %+v, want %+v", feed.Items, want)
+	}
+}
+
+func TestIsJSONFeed(t *testing.T) {
+	tests := []struct {
+		contentType string
+		body        string
+		want        bool
+	}{
+		{"application/feed+json", "", true},
+		{"application/json; charset=utf-8", "", true},
+		{"", "  {\"version\": \"1\"}", true},
+		{"text/xml", "<rss/>", false},
+		{"", "\xef\xbb\xbf<?xml version=\"1.0\"?>", false},
+	}
+	for _, test := range tests {
+		if got := isJSONFeed(test.contentType, []byte(test.body)); got != test.want {
+			t.Errorf("isJSONFeed(%q, %q) = %v, want %v", test.contentType, test.body, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,330 @@
+package httpfunctions
+
+import (
+	"context"
+	"database/sql"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/DreamyMemories/blog-aggregator/internal/database"
+	"github.com/google/uuid"
+)
+
+// maxOPMLSize caps uploaded OPML documents, exports from other readers are far smaller
+const maxOPMLSize = 5 << 20
+
+// opmlImportWorkers is how many entries of an import are fetched at once
+const opmlImportWorkers = 5
+
+// Statuses of an entry in an OPML import report
+const (
+	importCreated          = "created"
+	importFollowed         = "followed"
+	importAlreadyFollowing = "already_following"
+	importDuplicate        = "duplicate"
+	importFailed           = "failed"
+)
+
+type OPML struct {
+	XMLName xml.Name `xml:"opml"`
+	Version string   `xml:"version,attr"`
+	Head    OPMLHead `xml:"head"`
+	Body    OPMLBody `xml:"body"`
+}
+
+type OPMLHead struct {
+	Title       string `xml:"title"`
+	DateCreated string `xml:"dateCreated,omitempty"`
+}
+
+type OPMLBody struct {
+	Outlines []OPMLOutline `xml:"outline"`
+}
+
+// OPMLOutline is either a feed, when it has an xmlUrl, or a folder of outlines
+type OPMLOutline struct {
+	Text        string        `xml:"text,attr"`
+	Title       string        `xml:"title,attr,omitempty"`
+	Type        string        `xml:"type,attr,omitempty"`
+	XMLURL      string        `xml:"xmlUrl,attr,omitempty"`
+	HTMLURL     string        `xml:"htmlUrl,attr,omitempty"`
+	Description string        `xml:"description,attr,omitempty"`
+	Outlines    []OPMLOutline `xml:"outline"`
+}
+
+// OPMLImportEntry reports what happened to one feed of an imported OPML document
+type OPMLImportEntry struct {
+	Url      string     `json:"url"`
+	Title    string     `json:"title"`
+	Category string     `json:"category,omitempty"`
+	Status   string     `json:"status"`
+	FeedID   *uuid.UUID `json:"feed_id,omitempty"`
+	Error    string     `json:"error,omitempty"`
+}
+
+func parseOPML(body []byte) (OPML, error) {
+	opml := OPML{}
+	err := newXMLDecoder(toUTF8("", body)).Decode(&opml)
+	return opml, err
+}
+
+// entries flattens the outlines into feeds, nested folder names become the category
+// joined with "/"
+func (opml OPML) entries() []OPMLImportEntry {
+	var entries []OPMLImportEntry
+	var walk func(outlines []OPMLOutline, category string)
+	walk = func(outlines []OPMLOutline, category string) {
+		for _, outline := range outlines {
+			title := strings.TrimSpace(outline.Title)
+			if title == "" {
+				title = strings.TrimSpace(outline.Text)
+			}
+			if url := strings.TrimSpace(outline.XMLURL); url != "" {
+				entries = append(entries, OPMLImportEntry{Url: url, Title: title, Category: category})
+				continue
+			}
+			folder := category
+			if title != "" {
+				folder = strings.Trim(category+"/"+title, "/")
+			}
+			walk(outline.Outlines, folder)
+		}
+	}
+	walk(opml.Body.Outlines, "")
+	return entries
+}
+
+func (apiConfig *ApiConfig) handlerOPML(w http.ResponseWriter, r *http.Request, user database.User) {
+	ctx := r.Context()
+	if r.Method == http.MethodGet {
+		feeds, err := apiConfig.DB.GetFollowedFeedsByUser(ctx, user.ID)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Failed to fetch feed follows")
+			return
+		}
+		document, err := xml.MarshalIndent(exportOPML(user, feeds), "", "  ")
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Failed to render OPML "+err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", "text/x-opml; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="subscriptions.opml"`)
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(xml.Header))
+		w.Write(document)
+		w.Write([]byte("\n"))
+	} else if r.Method == http.MethodPost {
+		body, err := readOPMLUpload(w, r)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Could not read OPML upload: "+err.Error())
+			return
+		}
+		opml, err := parseOPML(body)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid OPML document: "+err.Error())
+			return
+		}
+
+		follows, err := apiConfig.DB.GetFeedFollowsByUser(ctx, user.ID)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Failed to fetch feed follows")
+			return
+		}
+		importer := &opmlImporter{
+			apiConfig: apiConfig,
+			user:      user,
+			followed:  map[uuid.UUID]bool{},
+		}
+		for _, follow := range follows {
+			importer.followed[follow.FeedID] = true
+		}
+
+		// Entries are independent, so fetch new feeds a few at a time
+		entries := opml.entries()
+		seen := map[string]bool{}
+		indexes := make(chan int)
+		var wg sync.WaitGroup
+		for i := 0; i < opmlImportWorkers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for index := range indexes {
+					importer.importEntry(ctx, &entries[index])
+				}
+			}()
+		}
+		for index := range entries {
+			if seen[entries[index].Url] {
+				entries[index].Status = importDuplicate
+				continue
+			}
+			seen[entries[index].Url] = true
+			indexes <- index
+		}
+		close(indexes)
+		wg.Wait()
+
+		counts := map[string]int{}
+		for _, entry := range entries {
+			counts[entry.Status]++
+		}
+		respondWithJson(w, http.StatusOK, struct {
+			Created          int               `json:"created"`
+			Followed         int               `json:"followed"`
+			AlreadyFollowing int               `json:"already_following"`
+			Duplicate        int               `json:"duplicate"`
+			Failed           int               `json:"failed"`
+			Entries          []OPMLImportEntry `json:"entries"`
+		}{
+			Created:          counts[importCreated],
+			Followed:         counts[importFollowed],
+			AlreadyFollowing: counts[importAlreadyFollowing],
+			Duplicate:        counts[importDuplicate],
+			Failed:           counts[importFailed],
+			Entries:          entries,
+		})
+	}
+}
+
+// exportOPML renders followed feeds as an OPML 2.0 document, categories become nested
+// folders and the per-user title is preferred over the feed's name
+func exportOPML(user database.User, feeds []database.GetFollowedFeedsByUserRow) OPML {
+	opml := OPML{
+		Version: "2.0",
+		Head:    OPMLHead{Title: user.Name + " subscriptions"},
+	}
+	for _, feed := range feeds {
+		title := feed.Name
+		if feed.Title.Valid && feed.Title.String != "" {
+			title = feed.Title.String
+		}
+		var path []string
+		for _, folder := range strings.Split(feed.Category.String, "/") {
+			if folder = strings.TrimSpace(folder); folder != "" {
+				path = append(path, folder)
+			}
+		}
+		outlines := opmlFolder(&opml.Body.Outlines, path)
+		*outlines = append(*outlines, OPMLOutline{
+			Text:        title,
+			Title:       title,
+			Type:        "rss",
+			XMLURL:      feed.Url,
+			HTMLURL:     feed.SiteUrl.String,
+			Description: feed.Description.String,
+		})
+	}
+	return opml
+}
+
+// opmlFolder returns the outlines of the folder at path, creating the missing folders
+func opmlFolder(outlines *[]OPMLOutline, path []string) *[]OPMLOutline {
+	if len(path) == 0 {
+		return outlines
+	}
+	for i := range *outlines {
+		if (*outlines)[i].XMLURL == "" && (*outlines)[i].Text == path[0] {
+			return opmlFolder(&(*outlines)[i].Outlines, path[1:])
+		}
+	}
+	*outlines = append(*outlines, OPMLOutline{Text: path[0], Title: path[0]})
+	return opmlFolder(&(*outlines)[len(*outlines)-1].Outlines, path[1:])
+}
+
+// readOPMLUpload accepts the document either as the raw request body or as the "file"
+// field of a multipart form
+func readOPMLUpload(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxOPMLSize)
+	if mediaType(r.Header.Get("Content-Type")) != "multipart/form-data" {
+		return io.ReadAll(r.Body)
+	}
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return io.ReadAll(file)
+}
+
+// opmlImporter follows the feeds of an OPML document for one user
+type opmlImporter struct {
+	apiConfig *ApiConfig
+	user      database.User
+
+	mu       sync.Mutex
+	followed map[uuid.UUID]bool
+}
+
+// importEntry follows the entry's feed, creating it first if nobody has added it yet,
+// and records the outcome on the entry
+func (importer *opmlImporter) importEntry(ctx context.Context, entry *OPMLImportEntry) {
+	db := importer.apiConfig.DB
+	feed, err := importer.apiConfig.storedFeed(ctx, entry.Url)
+	if errors.Is(err, sql.ErrNoRows) {
+		var result FetchResult
+		result, err = importer.apiConfig.Fetcher.UrlToFeed(ctx, entry.Url, Validators{})
+		if err != nil {
+			entry.Status = importFailed
+			entry.Error = "Could not fetch feed: " + err.Error()
+			return
+		}
+		// The feed may already be stored under the URL it moved to
+		feed, err = importer.apiConfig.storedFeed(ctx, result.PermanentURL)
+		if errors.Is(err, sql.ErrNoRows) {
+			// Creating the feed follows it too
+			feed, _, err = importer.apiConfig.createFeed(ctx, importer.user, entry.Title, entry.Url, result, entry.Category, entry.Title)
+			if err == nil {
+				importer.mu.Lock()
+				importer.followed[feed.ID] = true
+				importer.mu.Unlock()
+				entry.FeedID = &feed.ID
+				entry.Status = importCreated
+				return
+			}
+			// Another entry may have created the same feed meanwhile
+			if stored, lookupErr := importer.apiConfig.storedFeed(ctx, feedUrl(entry.Url, result)); lookupErr == nil {
+				feed, err = stored, nil
+			}
+		}
+	}
+	if err != nil {
+		entry.Status = importFailed
+		entry.Error = "Failed to create feed " + err.Error()
+		return
+	}
+	entry.FeedID = &feed.ID
+
+	// Several entries can lead to the same feed, only the first one follows it
+	importer.mu.Lock()
+	if importer.followed[feed.ID] {
+		importer.mu.Unlock()
+		entry.Status = importAlreadyFollowing
+		return
+	}
+	importer.followed[feed.ID] = true
+	importer.mu.Unlock()
+
+	_, err = db.CreateFeedFollow(ctx, database.CreateFeedFollowParams{
+		ID:        uuid.New(),
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+		FeedID:    feed.ID,
+		UserID:    importer.user.ID,
+		Category:  toNullString(entry.Category),
+		Title:     toNullString(entry.Title),
+	})
+	if err != nil {
+		importer.mu.Lock()
+		delete(importer.followed, feed.ID)
+		importer.mu.Unlock()
+		entry.Status = importFailed
+		entry.Error = "Failed to create feed follow " + err.Error()
+		return
+	}
+	entry.Status = importFollowed
+}
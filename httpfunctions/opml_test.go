@@ -0,0 +1,80 @@
+package httpfunctions
+
+import (
+	"database/sql"
+	"encoding/xml"
+	"reflect"
+	"testing"
+
+	"github.com/DreamyMemories/blog-aggregator/internal/database"
+)
+
+func TestOPMLRoundTrip(t *testing.T) {
+	feeds := []database.GetFollowedFeedsByUserRow{
+		{Name: "Loose", Url: "https://loose.example.com/feed"},
+		{
+			Category:    sql.NullString{String: "Tech", Valid: true},
+			Title:       sql.NullString{String: "My Go Blog", Valid: true},
+			Name:        "The Go Blog",
+			Url:         "https://go.dev/blog/feed.atom",
+			SiteUrl:     sql.NullString{String: "https://go.dev/blog", Valid: true},
+			Description: sql.NullString{String: "News & updates", Valid: true},
+		},
+		{Category: sql.NullString{String: "Tech/ Databases /", Valid: true}, Name: "Postgres", Url: "https://postgres.example.com/rss"},
+		{Category: sql.NullString{String: "Tech", Valid: true}, Name: "Second", Url: "https://second.example.com/rss?a=1&b=2"},
+	}
+
+	document, err := xml.Marshal(exportOPML(database.User{Name: "jane"}, feeds))
+	if err != nil {
+		t.Fatalf("xml.Marshal returned error: %v", err)
+	}
+	opml, err := parseOPML(append([]byte(xml.Header), document...))
+	if err != nil {
+		t.Fatalf("parseOPML returned error: %v", err)
+	}
+
+	if opml.Version != "2.0" || opml.Head.Title != "jane subscriptions" {
+		t.Errorf("head = %q %q", opml.Version, opml.Head.Title)
+	}
+	want := []OPMLImportEntry{
+		{Url: "https://loose.example.com/feed", Title: "Loose"},
+		{Url: "https://go.dev/blog/feed.atom", Title: "My Go Blog", Category: "Tech"},
+		{Url: "https://postgres.example.com/rss", Title: "Postgres", Category: "Tech/Databases"},
+		{Url: "https://second.example.com/rss?a=1&b=2", Title: "Second", Category: "Tech"},
+	}
+	if got := opml.entries(); !reflect.DeepEqual(got, want) {
+		t.Errorf("entries() = %+v, want %+v", got, want)
+	}
+	if outline := opml.Body.Outlines[1].Outlines[0]; outline.HTMLURL != "https://go.dev/blog" || outline.Description != "News & updates" {
+		t.Errorf("outline = %+v, want its site url and description kept", outline)
+	}
+}
+
+func TestOPMLEntries(t *testing.T) {
+	document := `<?xml version="1.0" encoding="ISO-8859-1"?>
+<opml version="1.0">
+  <head><title>Exported from another reader</title></head>
+  <body>
+    <outline text="News">
+      <outline text="Caf` + "\xe9" + `" type="rss" xmlUrl=" https://cafe.example.com/feed "/>
+      <outline title="World">
+        <outline text="Text only" title="Titled" xmlUrl="https://world.example.com/rss"/>
+      </outline>
+    </outline>
+    <outline text="" xmlUrl="https://untitled.example.com/atom"/>
+    <outline text="Empty folder"/>
+  </body>
+</opml>`
+	opml, err := parseOPML([]byte(document))
+	if err != nil {
+		t.Fatalf("parseOPML returned error: %v", err)
+	}
+	want := []OPMLImportEntry{
+		{Url: "https://cafe.example.com/feed", Title: "Café", Category: "News"},
+		{Url: "https://world.example.com/rss", Title: "Titled", Category: "News/World"},
+		{Url: "https://untitled.example.com/atom"},
+	}
+	if got := opml.entries(); !reflect.DeepEqual(got, want) {
+		t.Errorf("entries() = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,139 @@
+package httpfunctions
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// defaultPageSize and maxPageSize bound the limit query parameter of paginated listings
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+// pageCursor points at the last row of a page, listings are ordered by a timestamp with the
+// id breaking ties so rows sharing a timestamp are neither skipped nor repeated. Search results
+// are ordered by their rank first
+type pageCursor struct {
+	Rank float32
+	Time time.Time
+	ID   uuid.UUID
+}
+
+// Page is the envelope of paginated responses, NextCursor is null on the last page
+type Page struct {
+	Items      interface{} `json:"items"`
+	NextCursor *string     `json:"next_cursor"`
+}
+
+// pageRequest is the limit and cursor query parameters of a paginated request
+type pageRequest struct {
+	Limit  int32
+	Cursor *pageCursor
+}
+
+// String encodes the cursor opaquely, clients should only pass it back
+func (cursor pageCursor) String() string {
+	value := cursor.Time.UTC().Format(time.RFC3339Nano) + "|" + cursor.ID.String() + "|" +
+		strconv.FormatFloat(float64(cursor.Rank), 'g', -1, 32)
+	return base64.RawURLEncoding.EncodeToString([]byte(value))
+}
+
+func parseCursor(value string) (pageCursor, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return pageCursor{}, errInvalidCursor
+	}
+	parts := strings.Split(string(decoded), "|")
+	if len(parts) != 3 {
+		return pageCursor{}, errInvalidCursor
+	}
+	timestamp, id, rank := parts[0], parts[1], parts[2]
+	cursor := pageCursor{}
+	rank64, err := strconv.ParseFloat(rank, 32)
+	if err != nil {
+		return pageCursor{}, errInvalidCursor
+	}
+	cursor.Rank = float32(rank64)
+	cursor.Time, err = time.Parse(time.RFC3339Nano, timestamp)
+	if err != nil {
+		return pageCursor{}, errInvalidCursor
+	}
+	cursor.ID, err = uuid.Parse(id)
+	if err != nil {
+		return pageCursor{}, errInvalidCursor
+	}
+	return cursor, nil
+}
+
+// parsePageRequest reads the limit and cursor query parameters
+func parsePageRequest(r *http.Request) (pageRequest, error) {
+	page := pageRequest{Limit: defaultPageSize}
+	query := r.URL.Query()
+	if limit := query.Get("limit"); limit != "" {
+		lim, err := strconv.Atoi(limit)
+		if err != nil || lim < 1 {
+			return pageRequest{}, errors.New("invalid limit")
+		}
+		page.Limit = int32(min(lim, maxPageSize))
+	}
+	if value := query.Get("cursor"); value != "" {
+		cursor, err := parseCursor(value)
+		if err != nil {
+			return pageRequest{}, err
+		}
+		page.Cursor = &cursor
+	}
+	return page, nil
+}
+
+// pageSize is the number of rows to query, one more than the limit tells whether a next page exists
+func (page pageRequest) pageSize() int32 {
+	return page.Limit + 1
+}
+
+func (page pageRequest) cursorRank() sql.NullFloat64 {
+	if page.Cursor == nil {
+		return sql.NullFloat64{}
+	}
+	return sql.NullFloat64{Float64: float64(page.Cursor.Rank), Valid: true}
+}
+
+func (page pageRequest) cursorTime() sql.NullTime {
+	if page.Cursor == nil {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: page.Cursor.Time, Valid: true}
+}
+
+func (page pageRequest) cursorID() uuid.NullUUID {
+	if page.Cursor == nil {
+		return uuid.NullUUID{}
+	}
+	return uuid.NullUUID{UUID: page.Cursor.ID, Valid: true}
+}
+
+// newPage trims the extra row queried by pageSize and points the next cursor at the last
+// row returned
+func newPage[T any](items []T, request pageRequest, cursor func(T) pageCursor) Page {
+	page := Page{Items: items}
+	if len(items) > int(request.Limit) {
+		items = items[:request.Limit]
+		next := cursor(items[len(items)-1]).String()
+		page.Items = items
+		page.NextCursor = &next
+	}
+	if items == nil {
+		page.Items = []T{}
+	}
+	return page
+}
@@ -0,0 +1,101 @@
+package httpfunctions
+
+import (
+	"encoding/base64"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestPageCursorRoundTrip(t *testing.T) {
+	cursors := []pageCursor{
+		{Time: time.Date(2024, 5, 1, 12, 30, 0, 123456789, time.UTC), ID: uuid.MustParse("6ba7b810-9dad-11d1-80b4-00c04fd430c8")},
+		{Rank: 0.0607927, Time: time.Date(2006, 1, 2, 15, 4, 5, 0, time.FixedZone("", 2*60*60)), ID: uuid.New()},
+	}
+	for _, cursor := range cursors {
+		got, err := parseCursor(cursor.String())
+		if err != nil {
+			t.Fatalf("parseCursor(%q) returned error: %v", cursor.String(), err)
+		}
+		if got.Rank != cursor.Rank || !got.Time.Equal(cursor.Time) || got.ID != cursor.ID {
+			t.Errorf("parseCursor(%q) = %+v, want %+v", cursor.String(), got, cursor)
+		}
+	}
+}
+
+func TestParseCursorRejects(t *testing.T) {
+	encode := func(value string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(value))
+	}
+	tests := []struct {
+		name  string
+		value string
+	}{
+		{"not base64", "not a cursor!"},
+		{"padded base64", base64.URLEncoding.EncodeToString([]byte("2024-05-01T00:00:00Z|6ba7b810-9dad-11d1-80b4-00c04fd430c8|0"))},
+		{"missing rank", encode("2024-05-01T00:00:00Z|6ba7b810-9dad-11d1-80b4-00c04fd430c8")},
+		{"extra part", encode("2024-05-01T00:00:00Z|6ba7b810-9dad-11d1-80b4-00c04fd430c8|0|1")},
+		{"bad time", encode("yesterday|6ba7b810-9dad-11d1-80b4-00c04fd430c8|0")},
+		{"bad id", encode("2024-05-01T00:00:00Z|42|0")},
+		{"bad rank", encode("2024-05-01T00:00:00Z|6ba7b810-9dad-11d1-80b4-00c04fd430c8|high")},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got, err := parseCursor(test.value); err != errInvalidCursor {
+				t.Errorf("parseCursor(%q) = %+v, %v, want errInvalidCursor", test.value, got, err)
+			}
+		})
+	}
+}
+
+func TestParsePageRequest(t *testing.T) {
+	tests := []struct {
+		query     string
+		wantLimit int32
+		wantErr   bool
+	}{
+		{"", defaultPageSize, false},
+		{"?limit=5", 5, false},
+		{"?limit=1000", maxPageSize, false},
+		{"?limit=0", 0, true},
+		{"?limit=ten", 0, true},
+		{"?cursor=garbage", 0, true},
+	}
+	for _, test := range tests {
+		page, err := parsePageRequest(httptest.NewRequest("GET", "/v1/posts"+test.query, nil))
+		if (err != nil) != test.wantErr {
+			t.Errorf("parsePageRequest(%q) error = %v, want error %v", test.query, err, test.wantErr)
+			continue
+		}
+		if !test.wantErr && page.Limit != test.wantLimit {
+			t.Errorf("parsePageRequest(%q) limit = %v, want %v", test.query, page.Limit, test.wantLimit)
+		}
+	}
+}
+
+func TestNewPage(t *testing.T) {
+	cursor := func(n int) pageCursor {
+		return pageCursor{Time: time.Unix(int64(n), 0).UTC()}
+	}
+
+	page := newPage([]int{1, 2, 3}, pageRequest{Limit: 2}, cursor)
+	if items := page.Items.([]int); len(items) != 2 || page.NextCursor == nil {
+		t.Fatalf("newPage() = %v next %v, want 2 items and a next cursor", page.Items, page.NextCursor)
+	}
+	next, err := parseCursor(*page.NextCursor)
+	if err != nil || !next.Time.Equal(cursor(2).Time) {
+		t.Errorf("next cursor = %+v, %v, want the cursor of the last item returned", next, err)
+	}
+
+	page = newPage([]int{1, 2}, pageRequest{Limit: 2}, cursor)
+	if len(page.Items.([]int)) != 2 || page.NextCursor != nil {
+		t.Errorf("newPage() on the last page = %v next %v, want 2 items and no next cursor", page.Items, page.NextCursor)
+	}
+
+	page = newPage([]int(nil), pageRequest{Limit: 2}, cursor)
+	if items, ok := page.Items.([]int); !ok || items == nil {
+		t.Errorf("newPage(nil) items = %#v, want an empty slice so it encodes as []", page.Items)
+	}
+}
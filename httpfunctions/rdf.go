@@ -0,0 +1,82 @@
+package httpfunctions
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RDFFeed is an RSS 1.0 document, where items are siblings of the channel instead of its children
+type RDFFeed struct {
+	Channel struct {
+		Title       string `xml:"title"`
+		Link        string `xml:"link"`
+		Description string `xml:"description"`
+		Language    string `xml:"http://purl.org/dc/elements/1.1/ language"`
+		Syndication
+	} `xml:"channel"`
+	Item []RDFItem `xml:"item"`
+}
+
+type RDFItem struct {
+	About       string `xml:"http://www.w3.org/1999/02/22-rdf-syntax-ns# about,attr"`
+	Title       string `xml:"title"`
+	Link        string `xml:"link"`
+	Description string `xml:"description"`
+	DublinCore
+}
+
+// DublinCore holds the dc: elements used by RSS 1.0 and commonly found in RSS 2.0
+type DublinCore struct {
+	Date    string   `xml:"http://purl.org/dc/elements/1.1/ date"`
+	Creator string   `xml:"http://purl.org/dc/elements/1.1/ creator"`
+	Subject []string `xml:"http://purl.org/dc/elements/1.1/ subject"`
+}
+
+// Syndication holds the sy: elements publishers use to say how often a feed changes
+type Syndication struct {
+	UpdatePeriod    string `xml:"http://purl.org/rss/1.0/modules/syndication/ updatePeriod"`
+	UpdateFrequency string `xml:"http://purl.org/rss/1.0/modules/syndication/ updateFrequency"`
+}
+
+// interval returns the time between updates, which is the period divided by the frequency
+func (syndication Syndication) interval() time.Duration {
+	periods := map[string]time.Duration{
+		"hourly":  time.Hour,
+		"daily":   24 * time.Hour,
+		"weekly":  7 * 24 * time.Hour,
+		"monthly": 30 * 24 * time.Hour,
+		"yearly":  365 * 24 * time.Hour,
+	}
+	period, ok := periods[strings.ToLower(strings.TrimSpace(syndication.UpdatePeriod))]
+	if !ok {
+		return 0
+	}
+	frequency, err := strconv.Atoi(strings.TrimSpace(syndication.UpdateFrequency))
+	if err != nil || frequency < 1 {
+		frequency = 1
+	}
+	return period / time.Duration(frequency)
+}
+
+func (rdfFeed RDFFeed) toParsedFeed() ParsedFeed {
+	feed := ParsedFeed{
+		Title:          rdfFeed.Channel.Title,
+		Link:           rdfFeed.Channel.Link,
+		Description:    rdfFeed.Channel.Description,
+		Language:       rdfFeed.Channel.Language,
+		UpdateInterval: rdfFeed.Channel.interval(),
+	}
+	for _, item := range rdfFeed.Item {
+		feed.Items = append(feed.Items, FeedItem{
+			GUID:        item.About,
+			Title:       item.Title,
+			Link:        item.Link,
+			Description: item.Description,
+			PubDate:     item.Date,
+			Author:      item.Creator,
+			Categories:  item.Subject,
+		})
+	}
+	return feed
+}
@@ -0,0 +1,80 @@
+package httpfunctions
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+const rdfSample = `<?xml version="1.0"?>
+<rdf:RDF
+  xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+  xmlns="http://purl.org/rss/1.0/"
+  xmlns:dc="http://purl.org/dc/elements/1.1/"
+  xmlns:sy="http://purl.org/rss/1.0/modules/syndication/">
+  <channel rdf:about="https://example.com/">
+    <title>Example RDF</title>
+    <link>https://example.com/</link>
+    <description>An RSS 1.0 feed</description>
+    <dc:language>de</dc:language>
+    <sy:updatePeriod>daily</sy:updatePeriod>
+    <sy:updateFrequency>4</sy:updateFrequency>
+  </channel>
+  <item rdf:about="https://example.com/one">
+    <title>One</title>
+    <link>https://example.com/one</link>
+    <description>The first item</description>
+    <dc:date>2006-01-02T15:04:05+01:00</dc:date>
+    <dc:creator>Anna</dc:creator>
+    <dc:subject>news</dc:subject>
+    <dc:subject>politics</dc:subject>
+  </item>
+</rdf:RDF>`
+
+func TestParseFeedRDF(t *testing.T) {
+	feed, err := parseFeed("application/rdf+xml", []byte(rdfSample))
+	if err != nil {
+		t.Fatalf("parseFeed returned error: %v", err)
+	}
+
+	if feed.Title != "Example RDF" || feed.Link != "https://example.com/" || feed.Language != "de" {
+		t.Errorf("channel = %q %q %q", feed.Title, feed.Link, feed.Language)
+	}
+	if feed.UpdateInterval != 6*time.Hour {
+		t.Errorf("UpdateInterval = %v, want 6h", feed.UpdateInterval)
+	}
+
+	want := []FeedItem{{
+		GUID:        "https://example.com/one",
+		Title:       "One",
+		Link:        "https://example.com/one",
+		Description: "The first item",
+		PubDate:     "2006-01-02T15:04:05+01:00",
+		Author:      "Anna",
+		Categories:  []string{"news", "politics"},
+	}}
+	if !reflect.DeepEqual(feed.Items, want) {
+		t.Errorf("Items = %+v, want %+v", feed.Items, want)
+	}
+}
+
+func TestSyndicationInterval(t *testing.T) {
+	tests := []struct {
+		period    string
+		frequency string
+		want      time.Duration
+	}{
+		{"hourly", "", time.Hour},
+		{" Weekly ", "7", 24 * time.Hour},
+		{"daily", "0", 24 * time.Hour},
+		{"daily", "often", 24 * time.Hour},
+		{"fortnightly", "1", 0},
+		{"", "", 0},
+	}
+	for _, test := range tests {
+		syndication := Syndication{UpdatePeriod: test.period, UpdateFrequency: test.frequency}
+		if got := syndication.interval(); got != test.want {
+			t.Errorf("interval(%q, %q) = %v, want %v", test.period, test.frequency, got, test.want)
+		}
+	}
+}
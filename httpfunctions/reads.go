@@ -0,0 +1,128 @@
+package httpfunctions
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/DreamyMemories/blog-aggregator/internal/database"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// maxBulkPosts caps how many post ids one request may mark read or unread
+const maxBulkPosts = 1000
+
+// handlerMarkPostRead marks a single post read on POST and unread on DELETE
+func (apiConfig *ApiConfig) handlerMarkPostRead(w http.ResponseWriter, r *http.Request, user database.User) {
+	postID, err := uuid.Parse(mux.Vars(r)["postID"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Error parsing parameter")
+		return
+	}
+	apiConfig.markPosts(w, r, user, []uuid.UUID{postID}, r.Method == http.MethodPost)
+}
+
+// handlerMarkPostsRead marks the posts listed in the body read
+func (apiConfig *ApiConfig) handlerMarkPostsRead(w http.ResponseWriter, r *http.Request, user database.User) {
+	postIDs, ok := decodePostIDs(w, r)
+	if ok {
+		apiConfig.markPosts(w, r, user, postIDs, true)
+	}
+}
+
+// handlerMarkPostsUnread marks the posts listed in the body unread
+func (apiConfig *ApiConfig) handlerMarkPostsUnread(w http.ResponseWriter, r *http.Request, user database.User) {
+	postIDs, ok := decodePostIDs(w, r)
+	if ok {
+		apiConfig.markPosts(w, r, user, postIDs, false)
+	}
+}
+
+func decodePostIDs(w http.ResponseWriter, r *http.Request) ([]uuid.UUID, bool) {
+	var body struct {
+		PostIDs []uuid.UUID `json:"post_ids"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil || len(body.PostIDs) == 0 {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return nil, false
+	}
+	if len(body.PostIDs) > maxBulkPosts {
+		respondWithError(w, http.StatusBadRequest, "Too many post_ids, send at most 1000")
+		return nil, false
+	}
+	return body.PostIDs, true
+}
+
+// markPosts responds with how many posts changed state, posts outside the user's feeds are ignored
+func (apiConfig *ApiConfig) markPosts(w http.ResponseWriter, r *http.Request, user database.User, postIDs []uuid.UUID, read bool) {
+	var updated int64
+	var err error
+	if read {
+		updated, err = apiConfig.DB.MarkPostsRead(r.Context(), database.MarkPostsReadParams{
+			ReadAt:  time.Now().UTC(),
+			UserID:  user.ID,
+			PostIds: postIDs,
+		})
+	} else {
+		updated, err = apiConfig.DB.MarkPostsUnread(r.Context(), database.MarkPostsUnreadParams{
+			UserID:  user.ID,
+			PostIds: postIDs,
+		})
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to update read state "+err.Error())
+		return
+	}
+	respondWithJson(w, http.StatusOK, map[string]int64{"updated": updated})
+}
+
+// handlerMarkAllPostsRead marks every post published up to until as read, in one feed when
+// feed_id is given and in all followed feeds otherwise. until defaults to now
+func (apiConfig *ApiConfig) handlerMarkAllPostsRead(w http.ResponseWriter, r *http.Request, user database.User) {
+	var body struct {
+		Until  *time.Time `json:"until"`
+		FeedID *uuid.UUID `json:"feed_id"`
+	}
+	// The body is optional, an empty one marks everything read
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil && !errors.Is(err, io.EOF) {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	now := time.Now().UTC()
+	params := database.MarkAllPostsReadParams{
+		ReadAt: now,
+		UserID: user.ID,
+		Until:  now,
+	}
+	if body.Until != nil {
+		params.Until = *body.Until
+	}
+	if body.FeedID != nil {
+		params.FeedID = uuid.NullUUID{UUID: *body.FeedID, Valid: true}
+	}
+	updated, err := apiConfig.DB.MarkAllPostsRead(r.Context(), params)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to update read state "+err.Error())
+		return
+	}
+	respondWithJson(w, http.StatusOK, map[string]int64{"updated": updated})
+}
+
+// handlerGetUnreadCounts lists how many unread posts each followed feed has
+func (apiConfig *ApiConfig) handlerGetUnreadCounts(w http.ResponseWriter, r *http.Request, user database.User) {
+	counts, err := apiConfig.DB.GetUnreadCountsByUser(r.Context(), user.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Failed to count unread posts")
+		return
+	}
+	if counts == nil {
+		counts = []database.GetUnreadCountsByUserRow{}
+	}
+	respondWithJson(w, http.StatusOK, counts)
+}
@@ -0,0 +1,184 @@
+package httpfunctions
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// robotsCacheTTL is how long a host's robots.txt is trusted before fetching it again
+	robotsCacheTTL = 24 * time.Hour
+	// maxRobotsSize is the most of a robots.txt we read, as recommended by RFC 9309
+	maxRobotsSize = 500 * 1024
+)
+
+// ErrBlockedByRobots is returned by UrlToFeed when robots.txt disallows fetching the feed
+var ErrBlockedByRobots = errors.New("blocked by robots.txt")
+
+// robotsRule is an Allow or Disallow line of the group that applies to us
+type robotsRule struct {
+	allow   bool
+	pattern string
+}
+
+type robotsEntry struct {
+	rules   []robotsRule
+	expires time.Time
+}
+
+// robotsCache holds the parsed robots.txt of every host we fetch from, keyed by scheme and host
+type robotsCache struct {
+	mu      sync.Mutex
+	entries map[string]robotsEntry
+}
+
+// allowed reports whether robots.txt lets the fetcher's user agent fetch rawURL, fetching
+// and caching the host's robots.txt when needed
+func (cache *robotsCache) allowed(ctx context.Context, fetcher *Fetcher, rawURL string) (bool, error) {
+	target, err := url.Parse(rawURL)
+	if err != nil {
+		return false, err
+	}
+	key := target.Scheme + "://" + target.Host
+	cache.mu.Lock()
+	entry, ok := cache.entries[key]
+	cache.mu.Unlock()
+
+	if !ok || time.Now().After(entry.expires) {
+		rules, err := fetchRobots(ctx, fetcher, key)
+		if err != nil {
+			return false, err
+		}
+		entry = robotsEntry{rules: rules, expires: time.Now().Add(robotsCacheTTL)}
+		cache.mu.Lock()
+		cache.entries[key] = entry
+		cache.mu.Unlock()
+	}
+
+	path := target.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	if target.RawQuery != "" {
+		path += "?" + target.RawQuery
+	}
+	return robotsAllows(entry.rules, path), nil
+}
+
+// fetchRobots downloads and parses robots.txt. A missing robots.txt allows everything while
+// an unreachable one is an error, so the feed is retried later instead of fetched blindly
+func fetchRobots(ctx context.Context, fetcher *Fetcher, origin string) ([]robotsRule, error) {
+	response, release, err := fetcher.get(ctx, origin+"/robots.txt", nil)
+	if err != nil {
+		return nil, fmt.Errorf("fetching robots.txt: %w", err)
+	}
+	defer release()
+	defer response.Body.Close()
+
+	switch {
+	case response.StatusCode >= 500:
+		return nil, fmt.Errorf("fetching robots.txt: unexpected status %s", response.Status)
+	case response.StatusCode >= 400:
+		return nil, nil
+	}
+	body, err := fetcher.readBody(response)
+	if err != nil {
+		return nil, fmt.Errorf("fetching robots.txt: %w", err)
+	}
+	return parseRobots(bytes.NewReader(body[:min(len(body), maxRobotsSize)]), fetcher.userAgent), nil
+}
+
+// parseRobots returns the rules of the groups naming the product token of userAgent, ignoring
+// case, or of the * group when no group names us
+func parseRobots(body io.Reader, userAgent string) []robotsRule {
+	// The product token is the user agent up to its version or comment
+	product, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(userAgent)), "/")
+	product, _, _ = strings.Cut(product, " ")
+
+	var ownRules, wildcardRules []robotsRule
+	// named is set once a group names us, even one whose only rule is an empty Disallow
+	named := false
+	var groupAgents []string
+	inRules := false
+	scanner := bufio.NewScanner(body)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		field, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		field = strings.ToLower(strings.TrimSpace(field))
+		value = strings.TrimSpace(value)
+
+		switch field {
+		case "user-agent":
+			// A user-agent line after rules starts a new group
+			if inRules {
+				groupAgents = nil
+				inRules = false
+			}
+			groupAgents = append(groupAgents, strings.ToLower(value))
+		case "allow", "disallow":
+			inRules = true
+			rule := robotsRule{allow: field == "allow", pattern: value}
+			for _, agent := range groupAgents {
+				if agent == product {
+					named = true
+				}
+				// An empty Disallow allows everything, which is the same as having no rule
+				if field == "disallow" && value == "" {
+					continue
+				}
+				if agent == "*" {
+					wildcardRules = append(wildcardRules, rule)
+				} else if agent == product {
+					ownRules = append(ownRules, rule)
+				}
+			}
+		}
+	}
+
+	if named {
+		return ownRules
+	}
+	return wildcardRules
+}
+
+// robotsAllows applies the longest matching rule, with Allow winning ties
+func robotsAllows(rules []robotsRule, path string) bool {
+	allowed, longest := true, -1
+	for _, rule := range rules {
+		if !robotsMatch(rule.pattern, path) {
+			continue
+		}
+		if len(rule.pattern) > longest || (len(rule.pattern) == longest && rule.allow) {
+			allowed, longest = rule.allow, len(rule.pattern)
+		}
+	}
+	return allowed
+}
+
+// robotsMatch matches a path against a robots.txt pattern, where * matches any characters
+// and a trailing $ anchors the end of the path
+func robotsMatch(pattern string, path string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	parts := strings.Split(strings.TrimSuffix(pattern, "$"), "*")
+	for i, part := range parts {
+		parts[i] = regexp.QuoteMeta(part)
+	}
+	expression := "^" + strings.Join(parts, ".*")
+	if anchored {
+		expression += "$"
+	}
+	matched, err := regexp.MatchString(expression, path)
+	return err == nil && matched
+}
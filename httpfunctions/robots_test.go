@@ -0,0 +1,74 @@
+package httpfunctions
+
+import (
+	"strings"
+	"testing"
+)
+
+const robotsSample = `# Sample robots.txt
+User-agent: *
+Disallow: /private/
+Allow: /private/feed.xml
+
+User-agent: Blog-Aggregator
+User-agent: OtherBot
+Disallow: /drafts/   # not finished yet
+Disallow: /*.json$
+Allow: /drafts/public
+
+User-agent: blog
+Disallow: /
+
+User-agent: GoodBot
+Disallow:
+`
+
+func TestParseRobotsGroups(t *testing.T) {
+	tests := []struct {
+		name      string
+		userAgent string
+		path      string
+		want      bool
+	}{
+		{"own group ignores case", "blog-aggregator/1.0 (+https://example.com)", "/drafts/post", false},
+		{"own group allow wins on longer match", "blog-aggregator/1.0", "/drafts/public/feed", true},
+		{"own group anchored wildcard", "blog-aggregator/1.0", "/feed.json", false},
+		{"own group anchor not at end", "blog-aggregator/1.0", "/feed.json?page=2", true},
+		{"own group replaces the wildcard group", "blog-aggregator/1.0", "/private/", true},
+		{"product token is matched whole", "blogger/2.0", "/", true},
+		{"prefix of the product is not ours", "blog-aggregator/1.0", "/anything", true},
+		{"exact product token", "Blog", "/anything", false},
+		{"wildcard group", "SomeCrawler/3.1", "/private/page", false},
+		{"wildcard group allow", "SomeCrawler/3.1", "/private/feed.xml", true},
+		{"empty disallow allows everything", "GoodBot", "/private/page", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rules := parseRobots(strings.NewReader(robotsSample), test.userAgent)
+			if got := robotsAllows(rules, test.path); got != test.want {
+				t.Errorf("robotsAllows(%q) for %q = %v, want %v", test.path, test.userAgent, got, test.want)
+			}
+		})
+	}
+}
+
+func TestRobotsMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{"/", "/feed", true},
+		{"/feed", "/feed.xml", true},
+		{"/feed$", "/feed.xml", false},
+		{"/*/rss", "/blog/rss", true},
+		{"/*.php", "/index.php?x=1", true},
+		{"/a.b", "/axb", false},
+		{"/private", "/public", false},
+	}
+	for _, test := range tests {
+		if got := robotsMatch(test.pattern, test.path); got != test.want {
+			t.Errorf("robotsMatch(%q, %q) = %v, want %v", test.pattern, test.path, got, test.want)
+		}
+	}
+}
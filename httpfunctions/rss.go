@@ -1,46 +1,179 @@
 package httpfunctions
 
 import (
+	"bytes"
+	"encoding/json"
 	"encoding/xml"
-	"io"
-	"net/http"
+	"errors"
+	"strconv"
+	"strings"
 	"time"
 )
 
+// ParsedFeed is the format independent representation of a fetched feed
+type ParsedFeed struct {
+	Title       string
+	Link        string
+	Description string
+	Language    string
+	Items       []FeedItem
+
+	// Scheduling hints from the publisher, UpdateInterval is the minimum time between
+	// fetches and SkipHours/SkipDays are in UTC
+	UpdateInterval time.Duration
+	SkipHours      []int
+	SkipDays       []time.Weekday
+}
+
+// FeedItem is a single entry of a ParsedFeed, regardless of the source format
+type FeedItem struct {
+	GUID        string
+	Title       string
+	Link        string
+	Description string
+	Content     string
+	PubDate     string
+	Author      string
+	Categories  []string
+}
+
 type RSSFeed struct {
 	Channel struct {
 		Title       string    `xml:"title"`
 		Link        string    `xml:"link"`
 		Description string    `xml:"description"`
 		Language    string    `xml:"language"`
+		TTL         string    `xml:"ttl"`
+		SkipHours   []string  `xml:"skipHours>hour"`
+		SkipDays    []string  `xml:"skipDays>day"`
 		Item        []RSSItem `xml:"item"`
+		Syndication
 	} `xml:"channel"`
 }
 
 type RSSItem struct {
-	Title       string `xml:"title"`
-	Link        string `xml:"link"`
-	PubDate     string `xml:"pubDate"`
-	Description string `xml:"description"`
+	GUID        string   `xml:"guid"`
+	Title       string   `xml:"title"`
+	Link        string   `xml:"link"`
+	PubDate     string   `xml:"pubDate"`
+	Description string   `xml:"description"`
+	Author      string   `xml:"author"`
+	Category    []string `xml:"category"`
+	// Content is the full text from the content module, description often holds a summary
+	Content string `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
+	DublinCore
 }
 
-func UrlToFeed(url string) (RSSFeed, error) {
-	httpClient := http.Client{Timeout: 10 * time.Second}
+func (rssFeed RSSFeed) toParsedFeed() ParsedFeed {
+	feed := ParsedFeed{
+		Title:          rssFeed.Channel.Title,
+		Link:           rssFeed.Channel.Link,
+		Description:    rssFeed.Channel.Description,
+		Language:       rssFeed.Channel.Language,
+		UpdateInterval: rssFeed.Channel.interval(),
+	}
 
-	response, err := httpClient.Get(url)
-	if err != nil {
-		return RSSFeed{}, err
+	// ttl is in minutes and takes precedence over the syndication module
+	ttl, err := strconv.Atoi(strings.TrimSpace(rssFeed.Channel.TTL))
+	if err == nil && ttl > 0 {
+		feed.UpdateInterval = time.Duration(ttl) * time.Minute
+	}
+	for _, hour := range rssFeed.Channel.SkipHours {
+		h, err := strconv.Atoi(strings.TrimSpace(hour))
+		if err == nil && h >= 0 && h <= 24 {
+			feed.SkipHours = append(feed.SkipHours, h%24)
+		}
+	}
+	for _, day := range rssFeed.Channel.SkipDays {
+		for weekday := time.Sunday; weekday <= time.Saturday; weekday++ {
+			if strings.EqualFold(strings.TrimSpace(day), weekday.String()) {
+				feed.SkipDays = append(feed.SkipDays, weekday)
+			}
+		}
 	}
-	defer response.Body.Close()
 
-	body, err := io.ReadAll(response.Body)
-	if err != nil {
-		return RSSFeed{}, err
+	for _, item := range rssFeed.Channel.Item {
+		// Plenty of RSS 2.0 feeds use Dublin Core instead of the native elements
+		pubDate := item.PubDate
+		if pubDate == "" {
+			pubDate = item.Date
+		}
+		author := item.Author
+		if author == "" {
+			author = item.Creator
+		}
+		description := item.Description
+		if description == "" {
+			description = item.Content
+		}
+
+		feed.Items = append(feed.Items, FeedItem{
+			GUID:        item.GUID,
+			Title:       item.Title,
+			Link:        item.Link,
+			Description: description,
+			Content:     item.Content,
+			PubDate:     pubDate,
+			Author:      author,
+			Categories:  append(item.Category, item.Subject...),
+		})
 	}
-	rssFeed := RSSFeed{}
-	err = xml.Unmarshal(body, &rssFeed)
+	return feed
+}
+
+// parseFeed detects the format of the document and hands it to the matching parser
+func parseFeed(contentType string, body []byte) (ParsedFeed, error) {
+	if isJSONFeed(contentType, body) {
+		jsonFeed := JSONFeed{}
+		err := json.Unmarshal(bytes.TrimPrefix(body, []byte("\xef\xbb\xbf")), &jsonFeed)
+		if err != nil {
+			return ParsedFeed{}, err
+		}
+		return jsonFeed.toParsedFeed(), nil
+	}
+
+	body = toUTF8(contentType, body)
+	root, err := rootElement(body)
 	if err != nil {
-		return RSSFeed{}, err
+		return ParsedFeed{}, err
+	}
+
+	switch root.Local {
+	case "rss":
+		rssFeed := RSSFeed{}
+		err = newXMLDecoder(body).Decode(&rssFeed)
+		if err != nil {
+			return ParsedFeed{}, err
+		}
+		return rssFeed.toParsedFeed(), nil
+	case "feed":
+		atomFeed := AtomFeed{}
+		err = newXMLDecoder(body).Decode(&atomFeed)
+		if err != nil {
+			return ParsedFeed{}, err
+		}
+		return atomFeed.toParsedFeed(), nil
+	case "RDF":
+		rdfFeed := RDFFeed{}
+		err = newXMLDecoder(body).Decode(&rdfFeed)
+		if err != nil {
+			return ParsedFeed{}, err
+		}
+		return rdfFeed.toParsedFeed(), nil
+	}
+	return ParsedFeed{}, errors.New("unsupported feed format: <" + root.Local + ">")
+}
+
+// rootElement returns the name of the first element in an XML document
+func rootElement(body []byte) (xml.Name, error) {
+	decoder := newXMLDecoder(body)
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return xml.Name{}, err
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			return start.Name, nil
+		}
 	}
-	return rssFeed, nil
 }
@@ -0,0 +1,103 @@
+package httpfunctions
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+const rssSample = `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0" xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:content="http://purl.org/rss/1.0/modules/content/">
+  <channel>
+    <title>Example&nbsp;Blog</title>
+    <link>https://example.com/</link>
+    <description>Notes from the example team</description>
+    <language>en-us</language>
+    <ttl>90</ttl>
+    <skipHours><hour>0</hour><hour>24</hour><hour>7</hour></skipHours>
+    <skipDays><day>Saturday</day><day> sunday </day></skipDays>
+    <item>
+      <title>Hello world</title>
+      <link>https://example.com/hello</link>
+      <guid isPermaLink="false">post-1</guid>
+      <pubDate>Mon, 02 Jan 2006 15:04:05 GMT</pubDate>
+      <description>&lt;p&gt;First post&lt;/p&gt;</description>
+      <content:encoded><![CDATA[<p>First post, <em>in full</em></p>]]></content:encoded>
+      <author>jane@example.com (Jane)</author>
+      <category>news</category>
+      <category>go</category>
+    </item>
+    <item>
+      <title>Dublin Core</title>
+      <link>https://example.com/dc</link>
+      <dc:date>2006-01-03T10:00:00Z</dc:date>
+      <dc:creator>John</dc:creator>
+      <dc:subject>misc</dc:subject>
+      <content:encoded>&lt;p&gt;Only full text&lt;/p&gt;</content:encoded>
+    </item>
+  </channel>
+</rss>`
+
+func TestParseFeedRSS(t *testing.T) {
+	feed, err := parseFeed("application/rss+xml", []byte(rssSample))
+	if err != nil {
+		t.Fatalf("parseFeed returned error: %v", err)
+	}
+
+	if feed.Title != "Example\u00a0Blog" || feed.Link != "https://example.com/" || feed.Language != "en-us" {
+		t.Errorf("channel = %q %q %q", feed.Title, feed.Link, feed.Language)
+	}
+	if feed.UpdateInterval != 90*time.Minute {
+		t.Errorf("UpdateInterval = %v, want 1h30m", feed.UpdateInterval)
+	}
+	if want := []int{0, 0, 7}; !reflect.DeepEqual(feed.SkipHours, want) {
+		t.Errorf("SkipHours = %v, want %v", feed.SkipHours, want)
+	}
+	if want := []time.Weekday{time.Saturday, time.Sunday}; !reflect.DeepEqual(feed.SkipDays, want) {
+		t.Errorf("SkipDays = %v, want %v", feed.SkipDays, want)
+	}
+
+	want := []FeedItem{
+		{
+			GUID:        "post-1",
+			Title:       "Hello world",
+			Link:        "https://example.com/hello",
+			Description: "<p>First post</p>",
+			Content:     "<p>First post, <em>in full</em></p>",
+			PubDate:     "Mon, 02 Jan 2006 15:04:05 GMT",
+			Author:      "jane@example.com (Jane)",
+			Categories:  []string{"news", "go"},
+		},
+		{
+			Title:       "Dublin Core",
+			Link:        "https://example.com/dc",
+			Description: "<p>Only full text</p>",
+			Content:     "<p>Only full text</p>",
+			PubDate:     "2006-01-03T10:00:00Z",
+			Author:      "John",
+			Categories:  []string{"misc"},
+		},
+	}
+	if !reflect.DeepEqual(feed.Items, want) {
+		t.Errorf("Items = %+v, want %+v", feed.Items, want)
+	}
+}
+
+func TestParseFeedRejects(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"HTML page", "<!DOCTYPE html><html><head><title>Blog</title></head></html>"},
+		{"unknown root", `<?xml version="1.0"?><urlset></urlset>`},
+		{"not XML", "plain text"},
+		{"broken JSON", `{"version": "https://jsonfeed.org/version/1.1", "items": [`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := parseFeed("", []byte(test.body)); err == nil {
+				t.Errorf("parseFeed(%q) returned no error", test.body)
+			}
+		})
+	}
+}
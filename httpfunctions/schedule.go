@@ -0,0 +1,66 @@
+package httpfunctions
+
+import (
+	"slices"
+	"time"
+)
+
+const (
+	minFetchInterval = 10 * time.Minute
+	maxFetchInterval = 24 * time.Hour
+	// pollsPerPost is how many polls we aim for between two consecutive posts
+	pollsPerPost = 2
+	// observedPosts is how many of the latest posts are used to estimate the posting frequency
+	observedPosts = 10
+)
+
+// nextFetch works out how long to wait before fetching a feed again. The interval adapts to
+// how often the feed has posted recently, is never shorter than the publisher's ttl and
+// the next fetch is pushed out of any hours or days the publisher asked us to skip
+func nextFetch(now time.Time, feed ParsedFeed, current time.Duration) (time.Duration, time.Time) {
+	interval := current
+	if observed, ok := postingInterval(now, feed.Items); ok {
+		interval = observed / pollsPerPost
+	}
+	interval = max(interval, feed.UpdateInterval)
+	interval = min(max(interval, minFetchInterval), maxFetchInterval)
+
+	next := now.Add(interval).UTC()
+	for i := 0; i < 24*7 && isSkipped(next, feed); i++ {
+		next = next.Truncate(time.Hour).Add(time.Hour)
+	}
+	return interval, next
+}
+
+// postingInterval estimates the average time between posts from the latest dated items.
+// The time since the newest post counts as a gap too, so dormant feeds slow down
+func postingInterval(now time.Time, items []FeedItem) (time.Duration, bool) {
+	var dates []time.Time
+	for _, item := range items {
+		t, err := parsePubDate(item.PubDate)
+		if err == nil && !t.After(now) {
+			dates = append(dates, t)
+		}
+	}
+	if len(dates) < 2 {
+		return 0, false
+	}
+	slices.SortFunc(dates, func(a, b time.Time) int { return b.Compare(a) })
+	dates = dates[:min(len(dates), observedPosts)]
+
+	average := dates[0].Sub(dates[len(dates)-1]) / time.Duration(len(dates)-1)
+	return max(average, now.Sub(dates[0])), true
+}
+
+// failureBackoff doubles the wait before retrying a feed after every consecutive failure
+func failureBackoff(failures int32) time.Duration {
+	backoff := minFetchInterval
+	for i := int32(1); i < failures && backoff < maxFetchInterval; i++ {
+		backoff *= 2
+	}
+	return min(backoff, maxFetchInterval)
+}
+
+func isSkipped(t time.Time, feed ParsedFeed) bool {
+	return slices.Contains(feed.SkipHours, t.Hour()) || slices.Contains(feed.SkipDays, t.Weekday())
+}
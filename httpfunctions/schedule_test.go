@@ -0,0 +1,104 @@
+package httpfunctions
+
+import (
+	"testing"
+	"time"
+)
+
+// scheduleNow is a Wednesday at noon
+var scheduleNow = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+// postedAgo returns items published the given durations before scheduleNow
+func postedAgo(ages ...time.Duration) []FeedItem {
+	var items []FeedItem
+	for _, age := range ages {
+		items = append(items, FeedItem{PubDate: scheduleNow.Add(-age).Format(time.RFC3339)})
+	}
+	return items
+}
+
+func TestNextFetch(t *testing.T) {
+	tests := []struct {
+		name         string
+		feed         ParsedFeed
+		current      time.Duration
+		wantInterval time.Duration
+		wantNext     time.Time
+	}{
+		{"no posts keeps the interval", ParsedFeed{}, time.Hour, time.Hour, scheduleNow.Add(time.Hour)},
+		{"polls twice per post", ParsedFeed{Items: postedAgo(10*time.Minute, 2*time.Hour+10*time.Minute, 4*time.Hour+10*time.Minute)},
+			time.Hour, time.Hour, scheduleNow.Add(time.Hour)},
+		{"ttl is a floor", ParsedFeed{UpdateInterval: 3 * time.Hour, Items: postedAgo(10*time.Minute, 40*time.Minute, 70*time.Minute)},
+			time.Hour, 3 * time.Hour, scheduleNow.Add(3 * time.Hour)},
+		{"minimum interval", ParsedFeed{Items: postedAgo(time.Minute, 5*time.Minute, 9*time.Minute)},
+			time.Hour, minFetchInterval, scheduleNow.Add(minFetchInterval)},
+		{"maximum interval", ParsedFeed{}, 48 * time.Hour, maxFetchInterval, scheduleNow.Add(maxFetchInterval)},
+		{"dormant feed slows down", ParsedFeed{Items: postedAgo(30*24*time.Hour, 31*24*time.Hour)},
+			time.Hour, maxFetchInterval, scheduleNow.Add(maxFetchInterval)},
+		{"ttl above the maximum is capped", ParsedFeed{UpdateInterval: 7 * 24 * time.Hour}, time.Hour, maxFetchInterval, scheduleNow.Add(maxFetchInterval)},
+		{"skipped hours push the fetch out", ParsedFeed{SkipHours: []int{13, 14}}, time.Hour, time.Hour,
+			time.Date(2024, 5, 1, 15, 0, 0, 0, time.UTC)},
+		{"skipped hour starts at the next full hour", ParsedFeed{SkipHours: []int{12}}, 20 * time.Minute, 20 * time.Minute,
+			time.Date(2024, 5, 1, 13, 0, 0, 0, time.UTC)},
+		{"skipped days push the fetch out", ParsedFeed{SkipDays: []time.Weekday{time.Thursday}}, 24 * time.Hour, 24 * time.Hour,
+			time.Date(2024, 5, 3, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			interval, next := nextFetch(scheduleNow, test.feed, test.current)
+			if interval != test.wantInterval {
+				t.Errorf("interval = %v, want %v", interval, test.wantInterval)
+			}
+			if !next.Equal(test.wantNext) {
+				t.Errorf("next = %v, want %v", next, test.wantNext)
+			}
+		})
+	}
+}
+
+func TestPostingInterval(t *testing.T) {
+	tests := []struct {
+		name  string
+		items []FeedItem
+		want  time.Duration
+		ok    bool
+	}{
+		{"no posts", nil, 0, false},
+		{"single post", postedAgo(time.Hour), 0, false},
+		{"average gap", postedAgo(time.Minute, time.Hour+time.Minute, 3*time.Hour+time.Minute), 90 * time.Minute, true},
+		{"time since the newest post counts", postedAgo(5*time.Hour, 6*time.Hour), 5 * time.Hour, true},
+		{"undated and future posts are ignored",
+			append(postedAgo(-time.Hour, 0, 2*time.Hour), FeedItem{PubDate: "someday"}), 2 * time.Hour, true},
+		{"only the latest posts count",
+			postedAgo(0, time.Hour, 2*time.Hour, 3*time.Hour, 4*time.Hour, 5*time.Hour, 6*time.Hour, 7*time.Hour, 8*time.Hour, 9*time.Hour, 100*time.Hour),
+			time.Hour, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, ok := postingInterval(scheduleNow, test.items)
+			if got != test.want || ok != test.ok {
+				t.Errorf("postingInterval() = %v, %v, want %v, %v", got, ok, test.want, test.ok)
+			}
+		})
+	}
+}
+
+func TestFailureBackoff(t *testing.T) {
+	tests := []struct {
+		failures int32
+		want     time.Duration
+	}{
+		{0, minFetchInterval},
+		{1, minFetchInterval},
+		{2, 2 * minFetchInterval},
+		{3, 4 * minFetchInterval},
+		{8, 128 * minFetchInterval},
+		{9, maxFetchInterval},
+		{1000, maxFetchInterval},
+	}
+	for _, test := range tests {
+		if got := failureBackoff(test.failures); got != test.want {
+			t.Errorf("failureBackoff(%v) = %v, want %v", test.failures, got, test.want)
+		}
+	}
+}
@@ -2,88 +2,471 @@ package httpfunctions
 
 import (
 	"context"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"log"
+	"net/url"
+	"os"
 	"strings"
 	"sync"
 	"time"
+	"unicode/utf8"
 
 	"github.com/DreamyMemories/blog-aggregator/internal/database"
 	"github.com/google/uuid"
 )
 
-func StartScraping(db *database.Queries, concurrency int, timeBetweenRequest time.Duration) {
-	log.Printf("Scraping on %v gorountines every %s duration", concurrency, timeBetweenRequest)
-	ticker := time.NewTicker(timeBetweenRequest)
-	// Ensures the first one runs
-	for ; ; <-ticker.C {
-		feeds, err := db.GetNextFeedsToFetch(
-			context.Background(),
-			int32(concurrency),
-		)
+// feedLease is how long a claimed feed belongs to one scraper instance. It must outlast a
+// scrape, after it expires the feed is claimed again in case the instance crashed
+const feedLease = 5 * time.Minute
 
-		if err != nil {
-			log.Println("Error fetching feeds", err)
-			continue
+// errLeaseLost is returned when a feed's claim expired and another instance claimed it while
+// it was being scraped, that instance now owns the feed and records its outcome
+var errLeaseLost = errors.New("feed lease lost")
+
+// retryDelay is how long the dispatcher waits before topping up the queue when it is full
+// or there is a backlog of due feeds, instead of the full poll interval
+const retryDelay = time.Second
+
+// ScraperConfig controls the size of the scraper's worker pool
+type ScraperConfig struct {
+	// Workers is the number of feeds fetched concurrently
+	Workers int
+	// QueueDepth is the number of claimed feeds waiting for a free worker
+	QueueDepth int
+	// PollInterval is how often due feeds are looked for when there is no backlog
+	PollInterval time.Duration
+	// MaxFailures disables a feed after that many consecutive failures, 0 never does
+	MaxFailures int
+}
+
+// StartScraping runs a pool of workers fed from a queue of claimed feeds until ctx is
+// cancelled, so a slow feed only ever holds up its own worker. Scrapes already running
+// when ctx is cancelled are allowed to finish and queued feeds are released before
+// StartScraping returns
+func StartScraping(ctx context.Context, conn *sql.DB, db *database.Queries, fetcher *Fetcher, config ScraperConfig) {
+	config.Workers = max(config.Workers, 1)
+	config.QueueDepth = max(config.QueueDepth, 1)
+	instanceID := scraperInstanceID()
+	log.Printf("Scraper %s scraping due feeds on %v workers with a queue of %v, polling every %s",
+		instanceID, config.Workers, config.QueueDepth, config.PollInterval)
+
+	queue := make(chan database.Feed, config.QueueDepth)
+	// Workers are detached from ctx so a shutdown does not abort them mid-insert
+	workerCtx := context.WithoutCancel(ctx)
+	wg := &sync.WaitGroup{}
+	for i := 0; i < config.Workers; i++ {
+		wg.Add(1)
+		go scrapeWorker(ctx, workerCtx, wg, conn, db, fetcher, queue, config.MaxFailures)
+	}
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			releaseQueuedFeeds(workerCtx, db, queue)
+			log.Println("Scraper stopped")
+			return
+		case <-timer.C:
 		}
 
-		wg := &sync.WaitGroup{}
-		for _, feed := range feeds {
-			wg.Add(1)
+		free := cap(queue) - len(queue)
+		claimed := 0
+		if free > 0 {
+			feeds, err := db.ClaimNextFeedsToFetch(ctx, database.ClaimNextFeedsToFetchParams{
+				ClaimedBy:    toNullString(instanceID),
+				LeaseSeconds: int32(feedLease.Seconds()),
+				BatchSize:    int32(free),
+			})
+			if err != nil && ctx.Err() == nil {
+				log.Println("Error fetching feeds", err)
+			}
+			// Only the dispatcher sends, so this never blocks
+			for _, feed := range feeds {
+				queue <- feed
+			}
+			claimed = len(feeds)
+		}
 
-			go scrapeFeed(wg, db, feed)
+		if free == 0 || claimed == free {
+			timer.Reset(retryDelay)
+		} else {
+			timer.Reset(config.PollInterval)
 		}
+	}
+}
 
-		wg.Wait()
+// scrapeWorker scrapes feeds from the queue until stop is cancelled
+func scrapeWorker(stop context.Context, ctx context.Context, wg *sync.WaitGroup, conn *sql.DB, db *database.Queries, fetcher *Fetcher, queue <-chan database.Feed, maxFailures int) {
+	defer wg.Done()
+	for {
+		select {
+		case <-stop.Done():
+			return
+		case feed := <-queue:
+			// Both cases can be ready after a shutdown, a feed taken then is released
+			// instead of scraped
+			if stop.Err() != nil {
+				releaseFeedClaim(ctx, db, feed)
+				return
+			}
+			scrapeFeed(ctx, conn, db, fetcher, feed, maxFailures)
+		}
+	}
+}
+
+// releaseQueuedFeeds gives back the claims on feeds no worker got to, so another
+// instance can fetch them without waiting for the lease to expire
+func releaseQueuedFeeds(ctx context.Context, db *database.Queries, queue chan database.Feed) {
+	for {
+		select {
+		case feed := <-queue:
+			releaseFeedClaim(ctx, db, feed)
+		default:
+			return
+		}
+	}
+}
+
+// releaseFeedClaim gives back the claim on a feed that will not be scraped
+func releaseFeedClaim(ctx context.Context, db *database.Queries, feed database.Feed) {
+	err := db.ReleaseFeedClaim(ctx, database.ReleaseFeedClaimParams{
+		ID:        feed.ID,
+		ClaimedBy: feed.ClaimedBy,
+	})
+	if err != nil {
+		log.Println("Something went wrong in releasing the feed claim", err.Error())
 	}
 }
 
-func scrapeFeed(wg *sync.WaitGroup, db *database.Queries, feed database.Feed) {
-	defer wg.Done() // Tell WG to decrease count by one once done
-	rssFeed, err := UrlToFeed(feed.Url)
+// scraperInstanceID identifies this process when claiming feeds
+func scraperInstanceID() string {
+	hostname, err := os.Hostname()
 	if err != nil {
+		hostname = "unknown"
+	}
+	return fmt.Sprintf("%s-%d-%s", hostname, os.Getpid(), uuid.NewString()[:8])
+}
+
+func scrapeFeed(ctx context.Context, conn *sql.DB, db *database.Queries, fetcher *Fetcher, feed database.Feed, maxFailures int) {
+	result, err := fetcher.UrlToFeed(ctx, feed.Url, Validators{
+		ETag:         feed.Etag.String,
+		LastModified: feed.LastModified.String,
+	})
+	parsedFeed := result.Feed
+	var retryLater *RetryLaterError
+	if errors.As(err, &retryLater) {
+		log.Printf("Feed %s delayed: %v", feed.Name, err)
+		delayed, err := db.DelayFeedFetch(ctx, database.DelayFeedFetchParams{
+			ID:          feed.ID,
+			NextFetchAt: retryLater.Until,
+			ClaimedBy:   feed.ClaimedBy,
+		})
+		if err == nil && delayed == 0 {
+			err = errLeaseLost
+		}
+		if err != nil {
+			log.Println("Something went wrong in delaying the feed", err.Error())
+		}
+		return
+	}
+	if errors.Is(err, ErrBlockedByRobots) {
+		log.Printf("Feed %s is blocked by robots.txt", feed.Name)
+		blocked, err := db.MarkFeedBlocked(ctx, database.MarkFeedBlockedParams{
+			ID:          feed.ID,
+			LastError:   toNullString(ErrBlockedByRobots.Error()),
+			NextFetchAt: time.Now().Add(time.Duration(feed.FetchIntervalSeconds) * time.Second),
+			ClaimedBy:   feed.ClaimedBy,
+		})
+		if err == nil && blocked == 0 {
+			err = errLeaseLost
+		}
+		if err != nil {
+			log.Println("Something went wrong in marking the feed as blocked", err.Error())
+		}
+		return
+	}
+	if errors.Is(err, ErrFeedGone) {
+		log.Printf("Feed %s is gone, disabling it", feed.Name)
+		markFeedFailed(ctx, db, feed, err, 1)
+		return
+	}
+	notModified := errors.Is(err, ErrNotModified)
+	if err != nil && !notModified {
 		log.Println("Something went wrong in fetching feed", err.Error())
+		markFeedFailed(ctx, db, feed, err, maxFailures)
 		return
 	}
-	_, err = db.MarkFeedFetched(context.Background(), feed.ID)
+	feed, err = markFeedFetched(ctx, db, feed, result, notModified)
+	// Without the lease the posts are left to the instance that now owns the feed
 	if err != nil {
 		log.Println("Soemthing went wrong in updating the marked feed", err.Error())
 		return
 	}
+	if feed.RedirectCount >= permanentRedirectThreshold {
+		feed, err = moveFeed(ctx, conn, db, feed, feed.RedirectUrl.String)
+		if err != nil {
+			log.Println("Something went wrong in moving the feed", err.Error())
+			return
+		}
+	}
+	if notModified {
+		log.Printf("Feed %s not modified since last fetch", feed.Name)
+		return
+	}
 
-	// Test
-	for _, item := range rssFeed.Channel.Item {
+	newPosts, updatedPosts := storePosts(ctx, db, feed, parsedFeed)
+	log.Printf("Feed %s collected, %v posts found, %v new, %v updated", feed.Name, len(parsedFeed.Items), newPosts, updatedPosts)
+}
 
-		// Parse description
-		description := sql.NullString{}
-		if item.Description != "" {
-			description.String = item.Description
-			description.Valid = true
+// markFeedFetched schedules the next fetch of a successfully fetched feed and remembers its
+// validators and permanent redirect. The feed's claim must still be held, an unclaimed
+// feed such as a newly created one is updated as long as nobody claimed it meanwhile
+func markFeedFetched(ctx context.Context, db *database.Queries, feed database.Feed, result FetchResult, notModified bool) (database.Feed, error) {
+	// An unmodified feed keeps its interval, otherwise it adapts to the posts we got
+	interval := time.Duration(feed.FetchIntervalSeconds) * time.Second
+	nextFetchAt := time.Now().Add(interval)
+	if !notModified {
+		interval, nextFetchAt = nextFetch(time.Now(), result.Feed, interval)
+	}
+	// Count how many fetches in a row were permanently redirected to the same place
+	redirectCount := int32(0)
+	if result.PermanentURL != "" {
+		redirectCount = 1
+		if feed.RedirectUrl.String == result.PermanentURL {
+			redirectCount = feed.RedirectCount + 1
 		}
+	}
+	fetched, err := db.MarkFeedFetched(ctx, database.MarkFeedFetchedParams{
+		ID:                   feed.ID,
+		Etag:                 toNullString(result.Validators.ETag),
+		LastModified:         toNullString(result.Validators.LastModified),
+		FetchIntervalSeconds: int32(interval.Seconds()),
+		NextFetchAt:          nextFetchAt,
+		RedirectUrl:          toNullString(result.PermanentURL),
+		RedirectCount:        redirectCount,
+		ClaimedBy:            feed.ClaimedBy,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return feed, errLeaseLost
+	}
+	if err != nil {
+		return feed, err
+	}
+	return fetched, nil
+}
 
-		// Parse date
-		t, err := time.Parse(time.RFC1123Z, item.PubDate)
+// storePosts upserts the items of a parsed feed as posts of feed and returns how many
+// were new and how many were updated
+func storePosts(ctx context.Context, db *database.Queries, feed database.Feed, parsedFeed ParsedFeed) (int, int) {
+	newPosts, updatedPosts := 0, 0
+	for _, item := range parsedFeed.Items {
+		// Parse description
+		description := toNullString(item.Description)
+
+		// Parse date, falling back to the time we first saw the post
+		publishedAtInferred := false
+		t, err := parsePubDate(item.PubDate)
 		if err != nil {
-			log.Printf("Could not parse date %v with err %v", item.PubDate, err)
-		}
-
-		_, err = db.CreatePost(context.Background(), database.CreatePostParams{
-			ID:          uuid.New(),
-			CreatedAt:   time.Now().UTC(),
-			UpdatedAt:   time.Now().UTC(),
-			Title:       item.Title,
-			Description: description,
-			PublishedAt: t,
-			Url:         item.Link,
-			FeedID:      feed.ID,
+			log.Printf("Could not parse date %v with err %v, using first seen time", item.PubDate, err)
+			t = time.Now().UTC()
+			publishedAtInferred = true
+		}
+
+		guid := postGUID(item)
+		if guid == "" {
+			log.Printf("Skipping post %q from feed %s without id or link", item.Title, feed.Name)
+			continue
+		}
+
+		// Posts stored before guids existed were identified by their link alone
+		err = db.AdoptLegacyPost(ctx, database.AdoptLegacyPostParams{
+			Guid:   toNullString(guid),
+			FeedID: feed.ID,
+			Url:    item.Link,
 		})
+		if err != nil {
+			log.Println("Could not match legacy post", err.Error())
+		}
 
+		inserted, err := db.UpsertPost(ctx, database.UpsertPostParams{
+			ID:                  uuid.New(),
+			CreatedAt:           time.Now().UTC(),
+			UpdatedAt:           time.Now().UTC(),
+			Title:               item.Title,
+			Description:         description,
+			PublishedAt:         t,
+			Url:                 item.Link,
+			FeedID:              feed.ID,
+			PublishedAtInferred: publishedAtInferred,
+			Guid:                toNullString(guid),
+			Content:             toNullString(item.Content),
+			ContentHash:         contentHash(item),
+			Author:              toNullString(strings.TrimSpace(item.Author)),
+			Categories:          postCategories(item),
+		})
+		if errors.Is(err, sql.ErrNoRows) {
+			// Already stored and unchanged
+			continue
+		}
 		if err != nil {
-			if strings.Contains(err.Error(), "duplicate key") {
-				continue
-			}
 			log.Println("Could not create post", err.Error())
+			continue
+		}
+		if inserted {
+			newPosts++
+		} else {
+			updatedPosts++
+		}
+	}
+	return newPosts, updatedPosts
+}
+
+// contentHash fingerprints the parts of an item an author may edit after publishing
+func contentHash(item FeedItem) string {
+	hash := sha256.New()
+	for _, part := range []string{item.Title, item.Description, item.Content} {
+		hash.Write([]byte(part))
+		hash.Write([]byte{0})
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// permanentRedirectThreshold is how many fetches in a row must be permanently redirected to
+// the same URL before the feed's URL is updated, so a misconfigured server cannot move it
+const permanentRedirectThreshold = 3
+
+// moveFeed points feed at newURL. When another feed already has that URL the two are merged,
+// its followers and posts move over and the returned feed is the one that was already there.
+// Either the whole move happens or none of it. A url too long to store is recorded as the
+// feed's error and the feed stays where it is
+func moveFeed(ctx context.Context, conn *sql.DB, db *database.Queries, feed database.Feed, newURL string) (database.Feed, error) {
+	if utf8.RuneCountInString(newURL) > maxFeedUrlLength {
+		log.Printf("Feed %s moved permanently to a url longer than %v characters, keeping its url", feed.Name, maxFeedUrlLength)
+		err := db.RecordFeedError(ctx, database.RecordFeedErrorParams{
+			ID:        feed.ID,
+			LastError: toNullString(fmt.Sprintf("moved permanently to a url longer than %v characters: %s", maxFeedUrlLength, newURL)),
+		})
+		return feed, err
+	}
+
+	moved := feed
+	err := inTx(ctx, conn, db, func(tx *database.Queries) error {
+		existing, err := tx.GetFeedByUrl(ctx, newURL)
+		if errors.Is(err, sql.ErrNoRows) {
+			log.Printf("Feed %s moved permanently to %s", feed.Name, newURL)
+			moved, err = tx.UpdateFeedUrl(ctx, database.UpdateFeedUrlParams{
+				ID:  feed.ID,
+				Url: newURL,
+			})
+			return err
+		}
+		if err != nil {
+			return err
+		}
+
+		log.Printf("Feed %s moved permanently to %s, merging it into feed %s", feed.Name, newURL, existing.Name)
+		err = tx.MoveFeedFollows(ctx, database.MoveFeedFollowsParams{
+			ToFeedID:   existing.ID,
+			FromFeedID: feed.ID,
+		})
+		if err != nil {
+			return err
 		}
+		err = tx.MovePosts(ctx, database.MovePostsParams{
+			ToFeedID:   existing.ID,
+			FromFeedID: feed.ID,
+		})
+		if err != nil {
+			return err
+		}
+		moved = existing
+		return tx.DeleteFeed(ctx, feed.ID)
+	})
+	if err != nil {
+		return feed, err
+	}
+	return moved, nil
+}
+
+// markFeedFailed records the error on the feed and backs off exponentially, disabling
+// the feed once it reaches maxFailures consecutive failures
+func markFeedFailed(ctx context.Context, db *database.Queries, feed database.Feed, fetchErr error, maxFailures int) {
+	failures := feed.ConsecutiveFailures + 1
+	disable := maxFailures > 0 && failures >= int32(maxFailures)
+	_, err := db.MarkFeedFailed(ctx, database.MarkFeedFailedParams{
+		ID:          feed.ID,
+		LastError:   toNullString(fetchErr.Error()),
+		NextFetchAt: time.Now().Add(failureBackoff(failures)),
+		Disable:     disable,
+		ClaimedBy:   feed.ClaimedBy,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		err = errLeaseLost
+	}
+	if err != nil {
+		log.Println("Something went wrong in marking the feed as failed", err.Error())
+		return
+	}
+	if disable {
+		log.Printf("Feed %s disabled after %v consecutive failures", feed.Name, failures)
+	}
+}
+
+// trackingParams are query parameters that do not change which page a link points to
+var trackingParams = map[string]bool{
+	"fbclid": true, "gclid": true, "mc_cid": true, "mc_eid": true, "ref": true,
+}
+
+// postGUID identifies an item within its feed. When the feed provides no id the link
+// is used, stripped of tracking parameters so that changing them does not duplicate posts
+func postGUID(item FeedItem) string {
+	guid := strings.TrimSpace(item.GUID)
+	if guid != "" {
+		return guid
+	}
+	link := strings.TrimSpace(item.Link)
+	parsed, err := url.Parse(link)
+	if err != nil || parsed.RawQuery == "" {
+		return link
+	}
+	query := parsed.Query()
+	for key := range query {
+		if strings.HasPrefix(key, "utm_") || trackingParams[key] {
+			query.Del(key)
+		}
+	}
+	parsed.RawQuery = query.Encode()
+	return parsed.String()
+}
+
+// postCategories trims the item's categories and drops empty and repeated ones
+func postCategories(item FeedItem) []string {
+	categories := []string{}
+	seen := map[string]bool{}
+	for _, category := range item.Categories {
+		category = strings.TrimSpace(category)
+		if category != "" && !seen[category] {
+			seen[category] = true
+			categories = append(categories, category)
+		}
+	}
+	return categories
+}
+
+func toNullString(value string) sql.NullString {
+	return sql.NullString{String: value, Valid: value != ""}
+}
+
+// truncate cuts value to at most limit characters
+func truncate(value string, limit int) string {
+	if utf8.RuneCountInString(value) <= limit {
+		return value
 	}
-	log.Printf("Feed %s collected, %v posts found", feed.Name, len(rssFeed.Channel.Item))
+	return string([]rune(value)[:limit])
 }
@@ -0,0 +1,24 @@
+package httpfunctions
+
+import "testing"
+
+func TestPostGUID(t *testing.T) {
+	tests := []struct {
+		name string
+		item FeedItem
+		want string
+	}{
+		{"guid wins over link", FeedItem{GUID: " tag:example.com,2024:1 ", Link: "https://example.com/a"}, "tag:example.com,2024:1"},
+		{"link without query", FeedItem{Link: " https://example.com/a "}, "https://example.com/a"},
+		{"tracking params removed", FeedItem{Link: "https://example.com/a?utm_source=rss&utm_medium=feed&fbclid=x"}, "https://example.com/a"},
+		{"other params kept", FeedItem{Link: "https://example.com/a?id=7&utm_campaign=x&ref=home"}, "https://example.com/a?id=7"},
+		{"nothing to identify", FeedItem{Title: "No link"}, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := postGUID(test.item); got != test.want {
+				t.Errorf("postGUID() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
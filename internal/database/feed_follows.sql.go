@@ -7,15 +7,16 @@ package database
 
 import (
 	"context"
+	"database/sql"
 	"time"
 
 	"github.com/google/uuid"
 )
 
 const createFeedFollow = `-- name: CreateFeedFollow :one
-INSERT INTO feed_follows (id, created_at, updated_at, feed_id, user_id)
-VALUES ($1, $2, $3, $4, $5)
-RETURNING id, created_at, updated_at, user_id, feed_id
+INSERT INTO feed_follows (id, created_at, updated_at, feed_id, user_id, category, title)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+RETURNING id, created_at, updated_at, user_id, feed_id, category, title
 `
 
 type CreateFeedFollowParams struct {
@@ -24,6 +25,8 @@ type CreateFeedFollowParams struct {
 	UpdatedAt time.Time
 	FeedID    uuid.UUID
 	UserID    uuid.UUID
+	Category  sql.NullString
+	Title     sql.NullString
 }
 
 func (q *Queries) CreateFeedFollow(ctx context.Context, arg CreateFeedFollowParams) (FeedFollow, error) {
@@ -33,6 +36,8 @@ func (q *Queries) CreateFeedFollow(ctx context.Context, arg CreateFeedFollowPara
 		arg.UpdatedAt,
 		arg.FeedID,
 		arg.UserID,
+		arg.Category,
+		arg.Title,
 	)
 	var i FeedFollow
 	err := row.Scan(
@@ -41,6 +46,8 @@ func (q *Queries) CreateFeedFollow(ctx context.Context, arg CreateFeedFollowPara
 		&i.UpdatedAt,
 		&i.UserID,
 		&i.FeedID,
+		&i.Category,
+		&i.Title,
 	)
 	return i, err
 }
@@ -48,7 +55,7 @@ func (q *Queries) CreateFeedFollow(ctx context.Context, arg CreateFeedFollowPara
 const deleteFeedFollow = `-- name: DeleteFeedFollow :one
 DELETE FROM feed_follows
 WHERE id = $1
-RETURNING id, created_at, updated_at, user_id, feed_id
+RETURNING id, created_at, updated_at, user_id, feed_id, category, title
 `
 
 func (q *Queries) DeleteFeedFollow(ctx context.Context, id uuid.UUID) (FeedFollow, error) {
@@ -60,12 +67,14 @@ func (q *Queries) DeleteFeedFollow(ctx context.Context, id uuid.UUID) (FeedFollo
 		&i.UpdatedAt,
 		&i.UserID,
 		&i.FeedID,
+		&i.Category,
+		&i.Title,
 	)
 	return i, err
 }
 
 const getFeedFollowsByUser = `-- name: GetFeedFollowsByUser :many
-SELECT id, created_at, updated_at, user_id, feed_id FROM feed_follows
+SELECT id, created_at, updated_at, user_id, feed_id, category, title FROM feed_follows
 WHERE user_id = $1
 `
 
@@ -84,6 +93,128 @@ func (q *Queries) GetFeedFollowsByUser(ctx context.Context, userID uuid.UUID) ([
 			&i.UpdatedAt,
 			&i.UserID,
 			&i.FeedID,
+			&i.Category,
+			&i.Title,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getFeedFollowsByUserPage = `-- name: GetFeedFollowsByUserPage :many
+SELECT id, created_at, updated_at, user_id, feed_id, category, title FROM feed_follows
+WHERE user_id = $1
+  AND ($2::timestamptz IS NULL
+    OR (created_at, id) > ($2::timestamptz, $3::uuid))
+ORDER BY created_at ASC, id ASC
+LIMIT $4
+`
+
+type GetFeedFollowsByUserPageParams struct {
+	UserID          uuid.UUID
+	CursorCreatedAt sql.NullTime
+	CursorID        uuid.NullUUID
+	PageSize        int32
+}
+
+// Keyset pagination, oldest first, the cursor is the last follow of the previous page
+func (q *Queries) GetFeedFollowsByUserPage(ctx context.Context, arg GetFeedFollowsByUserPageParams) ([]FeedFollow, error) {
+	rows, err := q.db.QueryContext(ctx, getFeedFollowsByUserPage,
+		arg.UserID,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.PageSize,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []FeedFollow
+	for rows.Next() {
+		var i FeedFollow
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.UserID,
+			&i.FeedID,
+			&i.Category,
+			&i.Title,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const moveFeedFollows = `-- name: MoveFeedFollows :exec
+INSERT INTO feed_follows (id, created_at, updated_at, user_id, feed_id, category, title)
+SELECT gen_random_uuid(), NOW(), NOW(), user_id, $1::uuid, category, title
+FROM feed_follows
+WHERE feed_follows.feed_id = $2
+ON CONFLICT (user_id, feed_id) DO NOTHING
+`
+
+type MoveFeedFollowsParams struct {
+	ToFeedID   uuid.UUID
+	FromFeedID uuid.UUID
+}
+
+// Copies the follows of one feed to another, skipping users who already follow both
+func (q *Queries) MoveFeedFollows(ctx context.Context, arg MoveFeedFollowsParams) error {
+	_, err := q.db.ExecContext(ctx, moveFeedFollows, arg.ToFeedID, arg.FromFeedID)
+	return err
+}
+
+const getFollowedFeedsByUser = `-- name: GetFollowedFeedsByUser :many
+SELECT feed_follows.category, feed_follows.title, feeds.name, feeds.url, feeds.site_url, feeds.description
+FROM feed_follows
+JOIN feeds ON feeds.id = feed_follows.feed_id
+WHERE feed_follows.user_id = $1
+ORDER BY COALESCE(feed_follows.category, ''), LOWER(COALESCE(feed_follows.title, feeds.name)), feeds.url
+`
+
+type GetFollowedFeedsByUserRow struct {
+	Category    sql.NullString
+	Title       sql.NullString
+	Name        string
+	Url         string
+	SiteUrl     sql.NullString
+	Description sql.NullString
+}
+
+// Ordered by folder, title and url so repeated exports only differ where subscriptions changed
+func (q *Queries) GetFollowedFeedsByUser(ctx context.Context, userID uuid.UUID) ([]GetFollowedFeedsByUserRow, error) {
+	rows, err := q.db.QueryContext(ctx, getFollowedFeedsByUser, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetFollowedFeedsByUserRow
+	for rows.Next() {
+		var i GetFollowedFeedsByUserRow
+		if err := rows.Scan(
+			&i.Category,
+			&i.Title,
+			&i.Name,
+			&i.Url,
+			&i.SiteUrl,
+			&i.Description,
 		); err != nil {
 			return nil, err
 		}
@@ -7,24 +7,97 @@ package database
 
 import (
 	"context"
+	"database/sql"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+const claimNextFeedsToFetch = `-- name: ClaimNextFeedsToFetch :many
+UPDATE feeds
+SET claimed_by = $1,
+    claim_expires_at = NOW() + $2::integer * INTERVAL '1 second'
+WHERE id IN (
+    SELECT id FROM feeds
+    WHERE next_fetch_at <= NOW() AND disabled_at IS NULL
+      AND (claim_expires_at IS NULL OR claim_expires_at < NOW())
+    ORDER BY next_fetch_at ASC
+    LIMIT $3
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING id, created_at, updated_at, name, url, user_id, last_fetched_at, etag, last_modified, fetch_interval_seconds, next_fetch_at, last_error, last_error_at, consecutive_failures, disabled_at, claimed_by, claim_expires_at, redirect_url, redirect_count, description, site_url, language
+`
+
+type ClaimNextFeedsToFetchParams struct {
+	ClaimedBy    sql.NullString
+	LeaseSeconds int32
+	BatchSize    int32
+}
+
+// Leases due feeds to one scraper instance, SKIP LOCKED keeps concurrent claims disjoint
+// and feeds whose lease expired are claimed again in case their scraper crashed
+func (q *Queries) ClaimNextFeedsToFetch(ctx context.Context, arg ClaimNextFeedsToFetchParams) ([]Feed, error) {
+	rows, err := q.db.QueryContext(ctx, claimNextFeedsToFetch, arg.ClaimedBy, arg.LeaseSeconds, arg.BatchSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Feed
+	for rows.Next() {
+		var i Feed
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Name,
+			&i.Url,
+			&i.UserID,
+			&i.LastFetchedAt,
+			&i.Etag,
+			&i.LastModified,
+			&i.FetchIntervalSeconds,
+			&i.NextFetchAt,
+			&i.LastError,
+			&i.LastErrorAt,
+			&i.ConsecutiveFailures,
+			&i.DisabledAt,
+			&i.ClaimedBy,
+			&i.ClaimExpiresAt,
+			&i.RedirectUrl,
+			&i.RedirectCount,
+			&i.Description,
+			&i.SiteUrl,
+			&i.Language,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const createFeed = `-- name: CreateFeed :one
-INSERT INTO feeds (id, created_at, updated_at, name, url, user_id)
-VALUES ($1, $2, $3, $4, $5, $6)
-RETURNING id, created_at, updated_at, name, url, user_id, last_fetched_at
+INSERT INTO feeds (id, created_at, updated_at, name, url, user_id, description, site_url, language)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+RETURNING id, created_at, updated_at, name, url, user_id, last_fetched_at, etag, last_modified, fetch_interval_seconds, next_fetch_at, last_error, last_error_at, consecutive_failures, disabled_at, claimed_by, claim_expires_at, redirect_url, redirect_count, description, site_url, language
 `
 
 type CreateFeedParams struct {
-	ID        uuid.UUID
-	CreatedAt time.Time
-	UpdatedAt time.Time
-	Name      string
-	Url       string
-	UserID    uuid.UUID
+	ID          uuid.UUID
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	Name        string
+	Url         string
+	UserID      uuid.UUID
+	Description sql.NullString
+	SiteUrl     sql.NullString
+	Language    sql.NullString
 }
 
 func (q *Queries) CreateFeed(ctx context.Context, arg CreateFeedParams) (Feed, error) {
@@ -35,6 +108,9 @@ func (q *Queries) CreateFeed(ctx context.Context, arg CreateFeedParams) (Feed, e
 		arg.Name,
 		arg.Url,
 		arg.UserID,
+		arg.Description,
+		arg.SiteUrl,
+		arg.Language,
 	)
 	var i Feed
 	err := row.Scan(
@@ -45,16 +121,73 @@ func (q *Queries) CreateFeed(ctx context.Context, arg CreateFeedParams) (Feed, e
 		&i.Url,
 		&i.UserID,
 		&i.LastFetchedAt,
+		&i.Etag,
+		&i.LastModified,
+		&i.FetchIntervalSeconds,
+		&i.NextFetchAt,
+		&i.LastError,
+		&i.LastErrorAt,
+		&i.ConsecutiveFailures,
+		&i.DisabledAt,
+		&i.ClaimedBy,
+		&i.ClaimExpiresAt,
+		&i.RedirectUrl,
+		&i.RedirectCount,
+		&i.Description,
+		&i.SiteUrl,
+		&i.Language,
 	)
 	return i, err
 }
 
+const delayFeedFetch = `-- name: DelayFeedFetch :execrows
+UPDATE feeds
+SET next_fetch_at = $2, updated_at = NOW(), claimed_by = NULL, claim_expires_at = NULL
+WHERE id = $1 AND claimed_by IS NOT DISTINCT FROM $3
+`
+
+type DelayFeedFetchParams struct {
+	ID          uuid.UUID
+	NextFetchAt time.Time
+	ClaimedBy   sql.NullString
+}
+
+// Reschedules a feed without counting a failure, for hosts that asked us to slow down
+func (q *Queries) DelayFeedFetch(ctx context.Context, arg DelayFeedFetchParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, delayFeedFetch, arg.ID, arg.NextFetchAt, arg.ClaimedBy)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const deleteFeed = `-- name: DeleteFeed :exec
+DELETE FROM feeds
+WHERE id = $1
+`
+
+func (q *Queries) DeleteFeed(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, deleteFeed, id)
+	return err
+}
+
 const getAllFeed = `-- name: GetAllFeed :many
-SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at FROM feeds
+SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at, etag, last_modified, fetch_interval_seconds, next_fetch_at, last_error, last_error_at, consecutive_failures, disabled_at, claimed_by, claim_expires_at, redirect_url, redirect_count, description, site_url, language FROM feeds
+WHERE $1::timestamptz IS NULL
+   OR (created_at, id) > ($1::timestamptz, $2::uuid)
+ORDER BY created_at ASC, id ASC
+LIMIT $3
 `
 
-func (q *Queries) GetAllFeed(ctx context.Context) ([]Feed, error) {
-	rows, err := q.db.QueryContext(ctx, getAllFeed)
+type GetAllFeedParams struct {
+	CursorCreatedAt sql.NullTime
+	CursorID        uuid.NullUUID
+	PageSize        int32
+}
+
+// Keyset pagination, oldest first, the cursor is the last feed of the previous page
+func (q *Queries) GetAllFeed(ctx context.Context, arg GetAllFeedParams) ([]Feed, error) {
+	rows, err := q.db.QueryContext(ctx, getAllFeed, arg.CursorCreatedAt, arg.CursorID, arg.PageSize)
 	if err != nil {
 		return nil, err
 	}
@@ -70,6 +203,21 @@ func (q *Queries) GetAllFeed(ctx context.Context) ([]Feed, error) {
 			&i.Url,
 			&i.UserID,
 			&i.LastFetchedAt,
+			&i.Etag,
+			&i.LastModified,
+			&i.FetchIntervalSeconds,
+			&i.NextFetchAt,
+			&i.LastError,
+			&i.LastErrorAt,
+			&i.ConsecutiveFailures,
+			&i.DisabledAt,
+			&i.ClaimedBy,
+			&i.ClaimExpiresAt,
+			&i.RedirectUrl,
+			&i.RedirectCount,
+			&i.Description,
+			&i.SiteUrl,
+			&i.Language,
 		); err != nil {
 			return nil, err
 		}
@@ -84,52 +232,230 @@ func (q *Queries) GetAllFeed(ctx context.Context) ([]Feed, error) {
 	return items, nil
 }
 
-const getNextFeedsToFetch = `-- name: GetNextFeedsToFetch :many
-SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at FROM feeds
-ORDER BY last_fetched_at ASC NULLS FIRST
-LIMIT $1
+const getFeedByUrl = `-- name: GetFeedByUrl :one
+SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at, etag, last_modified, fetch_interval_seconds, next_fetch_at, last_error, last_error_at, consecutive_failures, disabled_at, claimed_by, claim_expires_at, redirect_url, redirect_count, description, site_url, language FROM feeds WHERE url = $1
 `
 
-func (q *Queries) GetNextFeedsToFetch(ctx context.Context, limit int32) ([]Feed, error) {
-	rows, err := q.db.QueryContext(ctx, getNextFeedsToFetch, limit)
+func (q *Queries) GetFeedByUrl(ctx context.Context, url string) (Feed, error) {
+	row := q.db.QueryRowContext(ctx, getFeedByUrl, url)
+	var i Feed
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Name,
+		&i.Url,
+		&i.UserID,
+		&i.LastFetchedAt,
+		&i.Etag,
+		&i.LastModified,
+		&i.FetchIntervalSeconds,
+		&i.NextFetchAt,
+		&i.LastError,
+		&i.LastErrorAt,
+		&i.ConsecutiveFailures,
+		&i.DisabledAt,
+		&i.ClaimedBy,
+		&i.ClaimExpiresAt,
+		&i.RedirectUrl,
+		&i.RedirectCount,
+		&i.Description,
+		&i.SiteUrl,
+		&i.Language,
+	)
+	return i, err
+}
+
+const markFeedBlocked = `-- name: MarkFeedBlocked :execrows
+UPDATE feeds
+SET updated_at = NOW(), last_error = $2, last_error_at = NOW(), next_fetch_at = $3,
+    claimed_by = NULL, claim_expires_at = NULL
+WHERE id = $1 AND claimed_by IS NOT DISTINCT FROM $4
+`
+
+type MarkFeedBlockedParams struct {
+	ID          uuid.UUID
+	LastError   sql.NullString
+	NextFetchAt time.Time
+	ClaimedBy   sql.NullString
+}
+
+// Records that robots.txt disallows the feed without counting a failure, it is checked again
+// on its normal schedule
+func (q *Queries) MarkFeedBlocked(ctx context.Context, arg MarkFeedBlockedParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, markFeedBlocked,
+		arg.ID,
+		arg.LastError,
+		arg.NextFetchAt,
+		arg.ClaimedBy,
+	)
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
-	defer rows.Close()
-	var items []Feed
-	for rows.Next() {
-		var i Feed
-		if err := rows.Scan(
-			&i.ID,
-			&i.CreatedAt,
-			&i.UpdatedAt,
-			&i.Name,
-			&i.Url,
-			&i.UserID,
-			&i.LastFetchedAt,
-		); err != nil {
-			return nil, err
-		}
-		items = append(items, i)
-	}
-	if err := rows.Close(); err != nil {
-		return nil, err
-	}
-	if err := rows.Err(); err != nil {
-		return nil, err
-	}
-	return items, nil
+	return result.RowsAffected()
+}
+
+const markFeedFailed = `-- name: MarkFeedFailed :one
+UPDATE feeds
+SET updated_at = NOW(), last_error = $2, last_error_at = NOW(),
+    consecutive_failures = consecutive_failures + 1, next_fetch_at = $3,
+    disabled_at = CASE WHEN $4::boolean THEN NOW() ELSE disabled_at END,
+    claimed_by = NULL, claim_expires_at = NULL
+WHERE id = $1 AND claimed_by IS NOT DISTINCT FROM $5
+RETURNING id, created_at, updated_at, name, url, user_id, last_fetched_at, etag, last_modified, fetch_interval_seconds, next_fetch_at, last_error, last_error_at, consecutive_failures, disabled_at, claimed_by, claim_expires_at, redirect_url, redirect_count, description, site_url, language
+`
+
+type MarkFeedFailedParams struct {
+	ID          uuid.UUID
+	LastError   sql.NullString
+	NextFetchAt time.Time
+	Disable     bool
+	ClaimedBy   sql.NullString
+}
+
+func (q *Queries) MarkFeedFailed(ctx context.Context, arg MarkFeedFailedParams) (Feed, error) {
+	row := q.db.QueryRowContext(ctx, markFeedFailed,
+		arg.ID,
+		arg.LastError,
+		arg.NextFetchAt,
+		arg.Disable,
+		arg.ClaimedBy,
+	)
+	var i Feed
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Name,
+		&i.Url,
+		&i.UserID,
+		&i.LastFetchedAt,
+		&i.Etag,
+		&i.LastModified,
+		&i.FetchIntervalSeconds,
+		&i.NextFetchAt,
+		&i.LastError,
+		&i.LastErrorAt,
+		&i.ConsecutiveFailures,
+		&i.DisabledAt,
+		&i.ClaimedBy,
+		&i.ClaimExpiresAt,
+		&i.RedirectUrl,
+		&i.RedirectCount,
+		&i.Description,
+		&i.SiteUrl,
+		&i.Language,
+	)
+	return i, err
 }
 
 const markFeedFetched = `-- name: MarkFeedFetched :one
 UPDATE feeds 
-SET last_fetched_at = NOW(), updated_at = NOW()
+SET last_fetched_at = NOW(), updated_at = NOW(), etag = $2, last_modified = $3,
+    fetch_interval_seconds = $4, next_fetch_at = $5, consecutive_failures = 0,
+    last_error = NULL, last_error_at = NULL,
+    claimed_by = NULL, claim_expires_at = NULL, redirect_url = $6, redirect_count = $7
+WHERE id = $1 AND claimed_by IS NOT DISTINCT FROM $8
+RETURNING id, created_at, updated_at, name, url, user_id, last_fetched_at, etag, last_modified, fetch_interval_seconds, next_fetch_at, last_error, last_error_at, consecutive_failures, disabled_at, claimed_by, claim_expires_at, redirect_url, redirect_count, description, site_url, language
+`
+
+type MarkFeedFetchedParams struct {
+	ID                   uuid.UUID
+	Etag                 sql.NullString
+	LastModified         sql.NullString
+	FetchIntervalSeconds int32
+	NextFetchAt          time.Time
+	RedirectUrl          sql.NullString
+	RedirectCount        int32
+	ClaimedBy            sql.NullString
+}
+
+// Only the instance holding the lease may update a claimed feed, no row means the lease was lost
+func (q *Queries) MarkFeedFetched(ctx context.Context, arg MarkFeedFetchedParams) (Feed, error) {
+	row := q.db.QueryRowContext(ctx, markFeedFetched,
+		arg.ID,
+		arg.Etag,
+		arg.LastModified,
+		arg.FetchIntervalSeconds,
+		arg.NextFetchAt,
+		arg.RedirectUrl,
+		arg.RedirectCount,
+		arg.ClaimedBy,
+	)
+	var i Feed
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Name,
+		&i.Url,
+		&i.UserID,
+		&i.LastFetchedAt,
+		&i.Etag,
+		&i.LastModified,
+		&i.FetchIntervalSeconds,
+		&i.NextFetchAt,
+		&i.LastError,
+		&i.LastErrorAt,
+		&i.ConsecutiveFailures,
+		&i.DisabledAt,
+		&i.ClaimedBy,
+		&i.ClaimExpiresAt,
+		&i.RedirectUrl,
+		&i.RedirectCount,
+		&i.Description,
+		&i.SiteUrl,
+		&i.Language,
+	)
+	return i, err
+}
+
+const recordFeedError = `-- name: RecordFeedError :exec
+UPDATE feeds
+SET updated_at = NOW(), last_error = $2, last_error_at = NOW()
+WHERE id = $1
+`
+
+type RecordFeedErrorParams struct {
+	ID        uuid.UUID
+	LastError sql.NullString
+}
+
+func (q *Queries) RecordFeedError(ctx context.Context, arg RecordFeedErrorParams) error {
+	_, err := q.db.ExecContext(ctx, recordFeedError, arg.ID, arg.LastError)
+	return err
+}
+
+const releaseFeedClaim = `-- name: ReleaseFeedClaim :exec
+UPDATE feeds
+SET claimed_by = NULL, claim_expires_at = NULL
+WHERE id = $1 AND claimed_by = $2
+`
+
+type ReleaseFeedClaimParams struct {
+	ID        uuid.UUID
+	ClaimedBy sql.NullString
+}
+
+func (q *Queries) ReleaseFeedClaim(ctx context.Context, arg ReleaseFeedClaimParams) error {
+	_, err := q.db.ExecContext(ctx, releaseFeedClaim, arg.ID, arg.ClaimedBy)
+	return err
+}
+
+const updateFeedUrl = `-- name: UpdateFeedUrl :one
+UPDATE feeds
+SET url = $2, redirect_url = NULL, redirect_count = 0, updated_at = NOW()
 WHERE id = $1
-RETURNING id, created_at, updated_at, name, url, user_id, last_fetched_at
+RETURNING id, created_at, updated_at, name, url, user_id, last_fetched_at, etag, last_modified, fetch_interval_seconds, next_fetch_at, last_error, last_error_at, consecutive_failures, disabled_at, claimed_by, claim_expires_at, redirect_url, redirect_count, description, site_url, language
 `
 
-func (q *Queries) MarkFeedFetched(ctx context.Context, id uuid.UUID) (Feed, error) {
-	row := q.db.QueryRowContext(ctx, markFeedFetched, id)
+type UpdateFeedUrlParams struct {
+	ID  uuid.UUID
+	Url string
+}
+
+func (q *Queries) UpdateFeedUrl(ctx context.Context, arg UpdateFeedUrlParams) (Feed, error) {
+	row := q.db.QueryRowContext(ctx, updateFeedUrl, arg.ID, arg.Url)
 	var i Feed
 	err := row.Scan(
 		&i.ID,
@@ -139,6 +465,21 @@ func (q *Queries) MarkFeedFetched(ctx context.Context, id uuid.UUID) (Feed, erro
 		&i.Url,
 		&i.UserID,
 		&i.LastFetchedAt,
+		&i.Etag,
+		&i.LastModified,
+		&i.FetchIntervalSeconds,
+		&i.NextFetchAt,
+		&i.LastError,
+		&i.LastErrorAt,
+		&i.ConsecutiveFailures,
+		&i.DisabledAt,
+		&i.ClaimedBy,
+		&i.ClaimExpiresAt,
+		&i.RedirectUrl,
+		&i.RedirectCount,
+		&i.Description,
+		&i.SiteUrl,
+		&i.Language,
 	)
 	return i, err
 }
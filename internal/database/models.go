@@ -12,13 +12,28 @@ import (
 )
 
 type Feed struct {
-	ID            uuid.UUID
-	CreatedAt     time.Time
-	UpdatedAt     time.Time
-	Name          string
-	Url           string
-	UserID        uuid.UUID
-	LastFetchedAt sql.NullTime
+	ID                   uuid.UUID
+	CreatedAt            time.Time
+	UpdatedAt            time.Time
+	Name                 string
+	Url                  string
+	UserID               uuid.UUID
+	LastFetchedAt        sql.NullTime
+	Etag                 sql.NullString
+	LastModified         sql.NullString
+	FetchIntervalSeconds int32
+	NextFetchAt          time.Time
+	LastError            sql.NullString
+	LastErrorAt          sql.NullTime
+	ConsecutiveFailures  int32
+	DisabledAt           sql.NullTime
+	ClaimedBy            sql.NullString
+	ClaimExpiresAt       sql.NullTime
+	RedirectUrl          sql.NullString
+	RedirectCount        int32
+	Description          sql.NullString
+	SiteUrl              sql.NullString
+	Language             sql.NullString
 }
 
 type FeedFollow struct {
@@ -27,17 +42,33 @@ type FeedFollow struct {
 	UpdatedAt time.Time
 	UserID    uuid.UUID
 	FeedID    uuid.UUID
+	Category  sql.NullString
+	Title     sql.NullString
 }
 
 type Post struct {
-	ID          uuid.UUID
-	CreatedAt   time.Time
-	UpdatedAt   time.Time
-	Title       string
-	Description sql.NullString
-	PublishedAt time.Time
-	Url         string
-	FeedID      uuid.UUID
+	ID                  uuid.UUID
+	CreatedAt           time.Time
+	UpdatedAt           time.Time
+	Title               string
+	Description         sql.NullString
+	PublishedAt         time.Time
+	Url                 string
+	FeedID              uuid.UUID
+	PublishedAtInferred bool
+	Guid                sql.NullString
+	Content             sql.NullString
+	ContentHash         string
+	RevisionCount       int32
+	Author              sql.NullString
+	Categories          []string
+	SearchVector        interface{}
+}
+
+type PostRead struct {
+	UserID uuid.UUID
+	PostID uuid.UUID
+	ReadAt time.Time
 }
 
 type User struct {
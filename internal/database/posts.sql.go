@@ -11,72 +11,244 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
-const createPost = `-- name: CreatePost :one
-INSERT INTO posts (id, created_at, updated_at, title, description, published_at, url, feed_id)
-VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
-RETURNING id, created_at, updated_at, title, description, published_at, url, feed_id
+const adoptLegacyPost = `-- name: AdoptLegacyPost :exec
+UPDATE posts
+SET guid = $1
+WHERE posts.feed_id = $2 AND posts.url = $3 AND posts.guid IS NULL
+  AND NOT EXISTS (
+    SELECT 1 FROM posts AS existing
+    WHERE existing.feed_id = $2 AND existing.guid = $1
+  )
 `
 
-type CreatePostParams struct {
-	ID          uuid.UUID
-	CreatedAt   time.Time
-	UpdatedAt   time.Time
-	Title       string
-	Description sql.NullString
-	PublishedAt time.Time
-	Url         string
-	FeedID      uuid.UUID
+type AdoptLegacyPostParams struct {
+	Guid   sql.NullString
+	FeedID uuid.UUID
+	Url    string
 }
 
-func (q *Queries) CreatePost(ctx context.Context, arg CreatePostParams) (Post, error) {
-	row := q.db.QueryRowContext(ctx, createPost,
-		arg.ID,
-		arg.CreatedAt,
-		arg.UpdatedAt,
-		arg.Title,
-		arg.Description,
-		arg.PublishedAt,
-		arg.Url,
-		arg.FeedID,
-	)
-	var i Post
-	err := row.Scan(
-		&i.ID,
-		&i.CreatedAt,
-		&i.UpdatedAt,
-		&i.Title,
-		&i.Description,
-		&i.PublishedAt,
-		&i.Url,
-		&i.FeedID,
-	)
-	return i, err
+// Gives a post stored before guids existed the guid of the item it came from, matched by
+// url, so the following UpsertPost updates it instead of inserting a duplicate
+func (q *Queries) AdoptLegacyPost(ctx context.Context, arg AdoptLegacyPostParams) error {
+	_, err := q.db.ExecContext(ctx, adoptLegacyPost, arg.Guid, arg.FeedID, arg.Url)
+	return err
 }
 
 const getPostsByUser = `-- name: GetPostsByUser :many
-SELECT posts.id, posts.created_at, posts.updated_at, posts.title, posts.description, posts.published_at, posts.url, posts.feed_id FROM posts
+SELECT posts.id, posts.created_at, posts.updated_at, posts.title, posts.description, posts.published_at, posts.url, posts.feed_id, posts.published_at_inferred, posts.guid, posts.content, posts.content_hash, posts.revision_count, posts.author, posts.categories, post_reads.read_at FROM posts
 JOIN feed_follows ON posts.feed_id = feed_follows.feed_id
+LEFT JOIN post_reads ON post_reads.post_id = posts.id AND post_reads.user_id = feed_follows.user_id
 WHERE feed_follows.user_id = $1
-ORDER BY posts.published_at DESC
-LIMIT $2
+  AND ($2::timestamptz IS NULL
+    OR (posts.published_at, posts.id) < ($2::timestamptz, $3::uuid))
+  AND (COALESCE(CARDINALITY($4::uuid[]), 0) = 0 OR posts.feed_id = ANY($4::uuid[]))
+  AND ($5::timestamptz IS NULL OR posts.published_at >= $5::timestamptz)
+  AND ($6::timestamptz IS NULL OR posts.published_at < $6::timestamptz)
+  AND ($7::text IS NULL OR LOWER(posts.author) = LOWER($7::text))
+  AND ($8::text IS NULL OR posts.categories @> ARRAY[$8::text])
+  AND (NOT $9::boolean OR post_reads.post_id IS NULL)
+ORDER BY posts.published_at DESC, posts.id DESC
+LIMIT $10
 `
 
 type GetPostsByUserParams struct {
-	UserID uuid.UUID
-	Limit  int32
+	UserID            uuid.UUID
+	CursorPublishedAt sql.NullTime
+	CursorID          uuid.NullUUID
+	FeedIds           []uuid.UUID
+	Since             sql.NullTime
+	Until             sql.NullTime
+	Author            sql.NullString
+	Category          sql.NullString
+	UnreadOnly        bool
+	PageSize          int32
+}
+
+type GetPostsByUserRow struct {
+	ID                  uuid.UUID
+	CreatedAt           time.Time
+	UpdatedAt           time.Time
+	Title               string
+	Description         sql.NullString
+	PublishedAt         time.Time
+	Url                 string
+	FeedID              uuid.UUID
+	PublishedAtInferred bool
+	Guid                sql.NullString
+	Content             sql.NullString
+	ContentHash         string
+	RevisionCount       int32
+	Author              sql.NullString
+	Categories          []string
+	ReadAt              sql.NullTime
+}
+
+// Keyset pagination, newest first, the cursor is the last post of the previous page.
+// Every filter is optional, an empty feed_ids or a NULL matches all posts
+func (q *Queries) GetPostsByUser(ctx context.Context, arg GetPostsByUserParams) ([]GetPostsByUserRow, error) {
+	rows, err := q.db.QueryContext(ctx, getPostsByUser,
+		arg.UserID,
+		arg.CursorPublishedAt,
+		arg.CursorID,
+		pq.Array(arg.FeedIds),
+		arg.Since,
+		arg.Until,
+		arg.Author,
+		arg.Category,
+		arg.UnreadOnly,
+		arg.PageSize,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetPostsByUserRow
+	for rows.Next() {
+		var i GetPostsByUserRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Title,
+			&i.Description,
+			&i.PublishedAt,
+			&i.Url,
+			&i.FeedID,
+			&i.PublishedAtInferred,
+			&i.Guid,
+			&i.Content,
+			&i.ContentHash,
+			&i.RevisionCount,
+			&i.Author,
+			pq.Array(&i.Categories),
+			&i.ReadAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const movePosts = `-- name: MovePosts :exec
+UPDATE posts
+SET feed_id = $1
+WHERE posts.feed_id = $2
+  AND NOT EXISTS (
+    SELECT 1 FROM posts AS existing
+    WHERE existing.feed_id = $1 AND existing.guid = posts.guid
+  )
+`
+
+type MovePostsParams struct {
+	ToFeedID   uuid.UUID
+	FromFeedID uuid.UUID
+}
+
+// Moves the posts of one feed to another, leaving behind those the other feed already has
+func (q *Queries) MovePosts(ctx context.Context, arg MovePostsParams) error {
+	_, err := q.db.ExecContext(ctx, movePosts, arg.ToFeedID, arg.FromFeedID)
+	return err
 }
 
-func (q *Queries) GetPostsByUser(ctx context.Context, arg GetPostsByUserParams) ([]Post, error) {
-	rows, err := q.db.QueryContext(ctx, getPostsByUser, arg.UserID, arg.Limit)
+const searchPostsByUser = `-- name: SearchPostsByUser :many
+WITH search AS (
+    SELECT websearch_to_tsquery('english', $1::text) AS tsquery
+), ranked AS (
+    SELECT posts.id,
+           posts.created_at,
+           posts.updated_at,
+           posts.title,
+           posts.description,
+           posts.published_at,
+           posts.url,
+           posts.feed_id,
+           posts.published_at_inferred,
+           posts.guid,
+           posts.content,
+           posts.content_hash,
+           posts.revision_count,
+           posts.author,
+           posts.categories,
+           ts_rank(posts.search_vector, search.tsquery) AS rank
+    FROM posts
+    JOIN feed_follows ON posts.feed_id = feed_follows.feed_id
+    CROSS JOIN search
+    WHERE feed_follows.user_id = $2
+      AND posts.search_vector @@ search.tsquery
+), page AS (
+    SELECT id, created_at, updated_at, title, description, published_at, url, feed_id, published_at_inferred, guid, content, content_hash, revision_count, author, categories, rank FROM ranked
+    WHERE $3::real IS NULL
+       OR (ranked.rank, ranked.published_at, ranked.id) < ($3::real, $4::timestamptz, $5::uuid)
+    ORDER BY ranked.rank DESC, ranked.published_at DESC, ranked.id DESC
+    LIMIT $6
+)
+SELECT page.id, page.created_at, page.updated_at, page.title, page.description, page.published_at, page.url, page.feed_id, page.published_at_inferred, page.guid, page.content, page.content_hash, page.revision_count, page.author, page.categories, page.rank,
+       ts_headline('english',
+           translate(regexp_replace(COALESCE(NULLIF(page.content, ''), NULLIF(page.description, ''), page.title), '<[^>]*>', ' ', 'g'), chr(2) || chr(3), ''),
+           search.tsquery,
+           'StartSel=' || chr(2) || ', StopSel=' || chr(3) || ', MaxFragments=2, MinWords=15, MaxWords=35')::text AS snippet
+FROM page
+CROSS JOIN search
+ORDER BY page.rank DESC, page.published_at DESC, page.id DESC
+`
+
+type SearchPostsByUserParams struct {
+	Query             string
+	UserID            uuid.UUID
+	CursorRank        sql.NullFloat64
+	CursorPublishedAt sql.NullTime
+	CursorID          uuid.NullUUID
+	PageSize          int32
+}
+
+type SearchPostsByUserRow struct {
+	ID                  uuid.UUID
+	CreatedAt           time.Time
+	UpdatedAt           time.Time
+	Title               string
+	Description         sql.NullString
+	PublishedAt         time.Time
+	Url                 string
+	FeedID              uuid.UUID
+	PublishedAtInferred bool
+	Guid                sql.NullString
+	Content             sql.NullString
+	ContentHash         string
+	RevisionCount       int32
+	Author              sql.NullString
+	Categories          []string
+	Rank                float32
+	Snippet             string
+}
+
+// Ranks the posts of followed feeds matching a web search style query ("phrases", or, -word)
+// and pages over (rank, published_at, id), snippets are only highlighted for the page returned
+func (q *Queries) SearchPostsByUser(ctx context.Context, arg SearchPostsByUserParams) ([]SearchPostsByUserRow, error) {
+	rows, err := q.db.QueryContext(ctx, searchPostsByUser,
+		arg.Query,
+		arg.UserID,
+		arg.CursorRank,
+		arg.CursorPublishedAt,
+		arg.CursorID,
+		arg.PageSize,
+	)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []Post
+	var items []SearchPostsByUserRow
 	for rows.Next() {
-		var i Post
+		var i SearchPostsByUserRow
 		if err := rows.Scan(
 			&i.ID,
 			&i.CreatedAt,
@@ -86,6 +258,15 @@ func (q *Queries) GetPostsByUser(ctx context.Context, arg GetPostsByUserParams)
 			&i.PublishedAt,
 			&i.Url,
 			&i.FeedID,
+			&i.PublishedAtInferred,
+			&i.Guid,
+			&i.Content,
+			&i.ContentHash,
+			&i.RevisionCount,
+			&i.Author,
+			pq.Array(&i.Categories),
+			&i.Rank,
+			&i.Snippet,
 		); err != nil {
 			return nil, err
 		}
@@ -99,3 +280,63 @@ func (q *Queries) GetPostsByUser(ctx context.Context, arg GetPostsByUserParams)
 	}
 	return items, nil
 }
+
+const upsertPost = `-- name: UpsertPost :one
+INSERT INTO posts (id, created_at, updated_at, title, description, published_at, url, feed_id, published_at_inferred, guid, content, content_hash, author, categories)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+ON CONFLICT (feed_id, guid) DO UPDATE
+SET title = EXCLUDED.title,
+    description = EXCLUDED.description,
+    content = EXCLUDED.content,
+    url = EXCLUDED.url,
+    content_hash = EXCLUDED.content_hash,
+    author = EXCLUDED.author,
+    categories = EXCLUDED.categories,
+    updated_at = CASE WHEN posts.content_hash IN ('', EXCLUDED.content_hash) THEN posts.updated_at ELSE EXCLUDED.updated_at END,
+    revision_count = CASE WHEN posts.content_hash IN ('', EXCLUDED.content_hash) THEN posts.revision_count ELSE posts.revision_count + 1 END
+WHERE posts.content_hash <> EXCLUDED.content_hash
+   OR posts.author IS DISTINCT FROM EXCLUDED.author
+   OR posts.categories <> EXCLUDED.categories
+RETURNING (xmax = 0) AS inserted
+`
+
+type UpsertPostParams struct {
+	ID                  uuid.UUID
+	CreatedAt           time.Time
+	UpdatedAt           time.Time
+	Title               string
+	Description         sql.NullString
+	PublishedAt         time.Time
+	Url                 string
+	FeedID              uuid.UUID
+	PublishedAtInferred bool
+	Guid                sql.NullString
+	Content             sql.NullString
+	ContentHash         string
+	Author              sql.NullString
+	Categories          []string
+}
+
+// Posts stored before content hashing existed get their hash without counting a revision,
+// and a changed author or categories are stored without counting one either
+func (q *Queries) UpsertPost(ctx context.Context, arg UpsertPostParams) (bool, error) {
+	row := q.db.QueryRowContext(ctx, upsertPost,
+		arg.ID,
+		arg.CreatedAt,
+		arg.UpdatedAt,
+		arg.Title,
+		arg.Description,
+		arg.PublishedAt,
+		arg.Url,
+		arg.FeedID,
+		arg.PublishedAtInferred,
+		arg.Guid,
+		arg.Content,
+		arg.ContentHash,
+		arg.Author,
+		pq.Array(arg.Categories),
+	)
+	var inserted bool
+	err := row.Scan(&inserted)
+	return inserted, err
+}
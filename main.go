@@ -1,10 +1,15 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
 	"time"
 
 	"github.com/DreamyMemories/blog-aggregator/httpfunctions"
@@ -13,6 +18,9 @@ import (
 	_ "github.com/lib/pq"
 )
 
+// shutdownTimeout bounds how long we wait for requests and scrapes to finish on shutdown
+const shutdownTimeout = 30 * time.Second
+
 func main() {
 	err := godotenv.Load()
 	if err != nil {
@@ -22,6 +30,23 @@ func main() {
 	port := os.Getenv("PORT")
 	dbURL := os.Getenv("CONNECTION_STRING")
 
+	// Scraper settings, feeds failing MaxFailures times in a row stop being fetched
+	workers := getEnvInt("SCRAPER_WORKERS", 10)
+	scraperConfig := httpfunctions.ScraperConfig{
+		Workers:      workers,
+		QueueDepth:   getEnvInt("SCRAPER_QUEUE_DEPTH", 2*workers),
+		PollInterval: getEnvDuration("SCRAPER_POLL_INTERVAL", time.Minute),
+		MaxFailures:  getEnvInt("FEED_MAX_FAILURES", 10),
+	}
+
+	// Shared HTTP client for fetching feeds, proxies come from HTTP_PROXY/HTTPS_PROXY/NO_PROXY
+	fetcher := httpfunctions.NewFetcher(httpfunctions.FetcherConfig{
+		UserAgent:    os.Getenv("FETCH_USER_AGENT"),
+		Timeout:      getEnvDuration("FETCH_TIMEOUT", 10*time.Second),
+		MaxBodySize:  int64(getEnvInt("FETCH_MAX_BODY_SIZE", 10<<20)),
+		MaxRedirects: getEnvInt("FETCH_MAX_REDIRECTS", 5),
+	})
+
 	// Load database
 	db, err := sql.Open("postgres", dbURL)
 	if err != nil {
@@ -29,19 +54,76 @@ func main() {
 	}
 	dbQueries := database.New(db)
 	apiConfig := &httpfunctions.ApiConfig{
-		DB: dbQueries,
+		Conn:    db,
+		DB:      dbQueries,
+		Fetcher: fetcher,
 	}
 
+	// Stop on SIGINT/SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	// Create Server
 	mux := httpfunctions.Mux(apiConfig)
 	server := &http.Server{
 		Addr:    ":" + port,
 		Handler: mux,
 	}
-	go httpfunctions.StartScraping(dbQueries, 10, time.Minute)
-	log.Println("Starting Server")
-	err = server.ListenAndServe()
+
+	scraperDone := make(chan struct{})
+	go func() {
+		httpfunctions.StartScraping(ctx, db, dbQueries, fetcher, scraperConfig)
+		close(scraperDone)
+	}()
+
+	go func() {
+		log.Println("Starting Server")
+		err := server.ListenAndServe()
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Error starting server: %v", err)
+		}
+	}()
+
+	<-ctx.Done()
+	log.Println("Shutting down, draining connections and running scrapes")
+
+	// Drain HTTP connections and wait for scrape workers, but not forever
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	err = server.Shutdown(shutdownCtx)
 	if err != nil {
-		log.Fatalf("Error starting server: %v", err)
+		log.Printf("Error shutting down server: %v", err)
+	}
+	select {
+	case <-scraperDone:
+		log.Println("Shutdown complete")
+	case <-shutdownCtx.Done():
+		log.Println("Timed out waiting for running scrapes")
+	}
+}
+
+// getEnvInt reads an optional integer setting, exiting if it is set but invalid
+func getEnvInt(name string, fallback int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	number, err := strconv.Atoi(value)
+	if err != nil || number < 0 {
+		log.Fatalf("Invalid %s: %q", name, value)
+	}
+	return number
+}
+
+// getEnvDuration reads an optional duration setting such as 30s or 5m, exiting if it is set but invalid
+func getEnvDuration(name string, fallback time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		log.Fatalf("Invalid %s: %q", name, value)
 	}
+	return duration
 }
@@ -1,6 +1,6 @@
 -- name: CreateFeedFollow :one
-INSERT INTO feed_follows (id, created_at, updated_at, feed_id, user_id)
-VALUES ($1, $2, $3, $4, $5)
+INSERT INTO feed_follows (id, created_at, updated_at, feed_id, user_id, category, title)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
 RETURNING *;
 
 -- name: DeleteFeedFollow :one
@@ -10,4 +10,29 @@ RETURNING *;
 
 -- name: GetFeedFollowsByUser :many
 SELECT * FROM feed_follows
-WHERE user_id = $1;
\ No newline at end of file
+WHERE user_id = $1;
+
+-- name: GetFeedFollowsByUserPage :many
+-- Keyset pagination, oldest first, the cursor is the last follow of the previous page
+SELECT * FROM feed_follows
+WHERE user_id = sqlc.arg(user_id)
+  AND (sqlc.narg(cursor_created_at)::timestamptz IS NULL
+    OR (created_at, id) > (sqlc.narg(cursor_created_at)::timestamptz, sqlc.narg(cursor_id)::uuid))
+ORDER BY created_at ASC, id ASC
+LIMIT sqlc.arg(page_size);
+
+-- name: MoveFeedFollows :exec
+-- Copies the follows of one feed to another, skipping users who already follow both
+INSERT INTO feed_follows (id, created_at, updated_at, user_id, feed_id, category, title)
+SELECT gen_random_uuid(), NOW(), NOW(), user_id, sqlc.arg(to_feed_id)::uuid, category, title
+FROM feed_follows
+WHERE feed_follows.feed_id = sqlc.arg(from_feed_id)
+ON CONFLICT (user_id, feed_id) DO NOTHING;
+
+-- name: GetFollowedFeedsByUser :many
+-- Ordered by folder, title and url so repeated exports only differ where subscriptions changed
+SELECT feed_follows.category, feed_follows.title, feeds.name, feeds.url, feeds.site_url, feeds.description
+FROM feed_follows
+JOIN feeds ON feeds.id = feed_follows.feed_id
+WHERE feed_follows.user_id = $1
+ORDER BY COALESCE(feed_follows.category, ''), LOWER(COALESCE(feed_follows.title, feeds.name)), feeds.url;
@@ -1,18 +1,84 @@
 -- name: CreateFeed :one
-INSERT INTO feeds (id, created_at, updated_at, name, url, user_id)
-VALUES ($1, $2, $3, $4, $5, $6)
+INSERT INTO feeds (id, created_at, updated_at, name, url, user_id, description, site_url, language)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
 RETURNING *;
 
--- name: GetAllFeed :many
-SELECT * FROM feeds;
+-- name: DeleteFeed :exec
+DELETE FROM feeds
+WHERE id = $1;
+
+-- name: DelayFeedFetch :execrows
+-- Reschedules a feed without counting a failure, for hosts that asked us to slow down
+UPDATE feeds
+SET next_fetch_at = $2, updated_at = NOW(), claimed_by = NULL, claim_expires_at = NULL
+WHERE id = $1 AND claimed_by IS NOT DISTINCT FROM $3;
 
--- name: GetNextFeedsToFetch :many
+-- name: GetAllFeed :many
+-- Keyset pagination, oldest first, the cursor is the last feed of the previous page
 SELECT * FROM feeds
-ORDER BY last_fetched_at ASC NULLS FIRST
-LIMIT $1;
+WHERE sqlc.narg(cursor_created_at)::timestamptz IS NULL
+   OR (created_at, id) > (sqlc.narg(cursor_created_at)::timestamptz, sqlc.narg(cursor_id)::uuid)
+ORDER BY created_at ASC, id ASC
+LIMIT sqlc.arg(page_size);
+
+-- name: GetFeedByUrl :one
+SELECT * FROM feeds WHERE url = $1;
+
+-- name: ClaimNextFeedsToFetch :many
+-- Leases due feeds to one scraper instance, SKIP LOCKED keeps concurrent claims disjoint
+-- and feeds whose lease expired are claimed again in case their scraper crashed
+UPDATE feeds
+SET claimed_by = sqlc.arg(claimed_by),
+    claim_expires_at = NOW() + sqlc.arg(lease_seconds)::integer * INTERVAL '1 second'
+WHERE id IN (
+    SELECT id FROM feeds
+    WHERE next_fetch_at <= NOW() AND disabled_at IS NULL
+      AND (claim_expires_at IS NULL OR claim_expires_at < NOW())
+    ORDER BY next_fetch_at ASC
+    LIMIT sqlc.arg(batch_size)
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING *;
 
 -- name: MarkFeedFetched :one
+-- Only the instance holding the lease may update a claimed feed, no row means the lease was lost
 UPDATE feeds 
-SET last_fetched_at = NOW(), updated_at = NOW()
+SET last_fetched_at = NOW(), updated_at = NOW(), etag = $2, last_modified = $3,
+    fetch_interval_seconds = $4, next_fetch_at = $5, consecutive_failures = 0,
+    last_error = NULL, last_error_at = NULL,
+    claimed_by = NULL, claim_expires_at = NULL, redirect_url = $6, redirect_count = $7
+WHERE id = $1 AND claimed_by IS NOT DISTINCT FROM $8
+RETURNING *;
+
+-- name: MarkFeedFailed :one
+UPDATE feeds
+SET updated_at = NOW(), last_error = $2, last_error_at = NOW(),
+    consecutive_failures = consecutive_failures + 1, next_fetch_at = $3,
+    disabled_at = CASE WHEN sqlc.arg(disable)::boolean THEN NOW() ELSE disabled_at END,
+    claimed_by = NULL, claim_expires_at = NULL
+WHERE id = $1 AND claimed_by IS NOT DISTINCT FROM $5
+RETURNING *;
+
+-- name: MarkFeedBlocked :execrows
+-- Records that robots.txt disallows the feed without counting a failure, it is checked again
+-- on its normal schedule
+UPDATE feeds
+SET updated_at = NOW(), last_error = $2, last_error_at = NOW(), next_fetch_at = $3,
+    claimed_by = NULL, claim_expires_at = NULL
+WHERE id = $1 AND claimed_by IS NOT DISTINCT FROM $4;
+
+-- name: RecordFeedError :exec
+UPDATE feeds
+SET updated_at = NOW(), last_error = $2, last_error_at = NOW()
+WHERE id = $1;
+
+-- name: ReleaseFeedClaim :exec
+UPDATE feeds
+SET claimed_by = NULL, claim_expires_at = NULL
+WHERE id = $1 AND claimed_by = $2;
+
+-- name: UpdateFeedUrl :one
+UPDATE feeds
+SET url = $2, redirect_url = NULL, redirect_count = 0, updated_at = NOW()
 WHERE id = $1
 RETURNING *;
\ No newline at end of file
@@ -0,0 +1,35 @@
+-- name: MarkPostsRead :execrows
+-- Only posts of feeds the user follows can be marked, posts already read keep their read_at
+INSERT INTO post_reads (user_id, post_id, read_at)
+SELECT feed_follows.user_id, posts.id, sqlc.arg(read_at)
+FROM posts
+JOIN feed_follows ON posts.feed_id = feed_follows.feed_id
+WHERE feed_follows.user_id = sqlc.arg(user_id)
+  AND posts.id = ANY(sqlc.arg(post_ids)::uuid[])
+ON CONFLICT (user_id, post_id) DO NOTHING;
+
+-- name: MarkPostsUnread :execrows
+DELETE FROM post_reads
+WHERE user_id = sqlc.arg(user_id)
+  AND post_id = ANY(sqlc.arg(post_ids)::uuid[]);
+
+-- name: MarkAllPostsRead :execrows
+-- Marks every post published up to a time as read, in one followed feed or in all of them
+INSERT INTO post_reads (user_id, post_id, read_at)
+SELECT feed_follows.user_id, posts.id, sqlc.arg(read_at)
+FROM posts
+JOIN feed_follows ON posts.feed_id = feed_follows.feed_id
+WHERE feed_follows.user_id = sqlc.arg(user_id)
+  AND posts.published_at <= sqlc.arg(until)::timestamptz
+  AND (sqlc.narg(feed_id)::uuid IS NULL OR posts.feed_id = sqlc.narg(feed_id)::uuid)
+ON CONFLICT (user_id, post_id) DO NOTHING;
+
+-- name: GetUnreadCountsByUser :many
+SELECT feeds.id AS feed_id, feeds.name, COUNT(posts.id) FILTER (WHERE post_reads.post_id IS NULL) AS unread_count
+FROM feed_follows
+JOIN feeds ON feeds.id = feed_follows.feed_id
+LEFT JOIN posts ON posts.feed_id = feeds.id
+LEFT JOIN post_reads ON post_reads.post_id = posts.id AND post_reads.user_id = feed_follows.user_id
+WHERE feed_follows.user_id = $1
+GROUP BY feeds.id, feeds.name
+ORDER BY feeds.name, feeds.id;
@@ -1,11 +1,103 @@
--- name: CreatePost :one
-INSERT INTO posts (id, created_at, updated_at, title, description, published_at, url, feed_id)
-VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
-RETURNING *;
+-- name: UpsertPost :one
+-- Posts stored before content hashing existed get their hash without counting a revision,
+-- and a changed author or categories are stored without counting one either
+INSERT INTO posts (id, created_at, updated_at, title, description, published_at, url, feed_id, published_at_inferred, guid, content, content_hash, author, categories)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+ON CONFLICT (feed_id, guid) DO UPDATE
+SET title = EXCLUDED.title,
+    description = EXCLUDED.description,
+    content = EXCLUDED.content,
+    url = EXCLUDED.url,
+    content_hash = EXCLUDED.content_hash,
+    author = EXCLUDED.author,
+    categories = EXCLUDED.categories,
+    updated_at = CASE WHEN posts.content_hash IN ('', EXCLUDED.content_hash) THEN posts.updated_at ELSE EXCLUDED.updated_at END,
+    revision_count = CASE WHEN posts.content_hash IN ('', EXCLUDED.content_hash) THEN posts.revision_count ELSE posts.revision_count + 1 END
+WHERE posts.content_hash <> EXCLUDED.content_hash
+   OR posts.author IS DISTINCT FROM EXCLUDED.author
+   OR posts.categories <> EXCLUDED.categories
+RETURNING (xmax = 0) AS inserted;
+
+-- name: AdoptLegacyPost :exec
+-- Gives a post stored before guids existed the guid of the item it came from, matched by
+-- url, so the following UpsertPost updates it instead of inserting a duplicate
+UPDATE posts
+SET guid = sqlc.arg(guid)
+WHERE posts.feed_id = sqlc.arg(feed_id) AND posts.url = sqlc.arg(url) AND posts.guid IS NULL
+  AND NOT EXISTS (
+    SELECT 1 FROM posts AS existing
+    WHERE existing.feed_id = sqlc.arg(feed_id) AND existing.guid = sqlc.arg(guid)
+  );
+
+-- name: MovePosts :exec
+-- Moves the posts of one feed to another, leaving behind those the other feed already has
+UPDATE posts
+SET feed_id = sqlc.arg(to_feed_id)
+WHERE posts.feed_id = sqlc.arg(from_feed_id)
+  AND NOT EXISTS (
+    SELECT 1 FROM posts AS existing
+    WHERE existing.feed_id = sqlc.arg(to_feed_id) AND existing.guid = posts.guid
+  );
 
 -- name: GetPostsByUser :many
-SELECT posts.* FROM posts
+-- Keyset pagination, newest first, the cursor is the last post of the previous page.
+-- Every filter is optional, an empty feed_ids or a NULL matches all posts
+SELECT posts.id, posts.created_at, posts.updated_at, posts.title, posts.description, posts.published_at, posts.url, posts.feed_id, posts.published_at_inferred, posts.guid, posts.content, posts.content_hash, posts.revision_count, posts.author, posts.categories, post_reads.read_at FROM posts
 JOIN feed_follows ON posts.feed_id = feed_follows.feed_id
-WHERE feed_follows.user_id = $1
-ORDER BY posts.published_at DESC
-LIMIT $2;
\ No newline at end of file
+LEFT JOIN post_reads ON post_reads.post_id = posts.id AND post_reads.user_id = feed_follows.user_id
+WHERE feed_follows.user_id = sqlc.arg(user_id)
+  AND (sqlc.narg(cursor_published_at)::timestamptz IS NULL
+    OR (posts.published_at, posts.id) < (sqlc.narg(cursor_published_at)::timestamptz, sqlc.narg(cursor_id)::uuid))
+  AND (COALESCE(CARDINALITY(sqlc.arg(feed_ids)::uuid[]), 0) = 0 OR posts.feed_id = ANY(sqlc.arg(feed_ids)::uuid[]))
+  AND (sqlc.narg(since)::timestamptz IS NULL OR posts.published_at >= sqlc.narg(since)::timestamptz)
+  AND (sqlc.narg(until)::timestamptz IS NULL OR posts.published_at < sqlc.narg(until)::timestamptz)
+  AND (sqlc.narg(author)::text IS NULL OR LOWER(posts.author) = LOWER(sqlc.narg(author)::text))
+  AND (sqlc.narg(category)::text IS NULL OR posts.categories @> ARRAY[sqlc.narg(category)::text])
+  AND (NOT sqlc.arg(unread_only)::boolean OR post_reads.post_id IS NULL)
+ORDER BY posts.published_at DESC, posts.id DESC
+LIMIT sqlc.arg(page_size);
+
+-- name: SearchPostsByUser :many
+-- Ranks the posts of followed feeds matching a web search style query ("phrases", or, -word)
+-- and pages over (rank, published_at, id), snippets are only highlighted for the page returned
+WITH search AS (
+    SELECT websearch_to_tsquery('english', sqlc.arg(query)::text) AS tsquery
+), ranked AS (
+    SELECT posts.id,
+           posts.created_at,
+           posts.updated_at,
+           posts.title,
+           posts.description,
+           posts.published_at,
+           posts.url,
+           posts.feed_id,
+           posts.published_at_inferred,
+           posts.guid,
+           posts.content,
+           posts.content_hash,
+           posts.revision_count,
+           posts.author,
+           posts.categories,
+           ts_rank(posts.search_vector, search.tsquery) AS rank
+    FROM posts
+    JOIN feed_follows ON posts.feed_id = feed_follows.feed_id
+    CROSS JOIN search
+    WHERE feed_follows.user_id = sqlc.arg(user_id)
+      AND posts.search_vector @@ search.tsquery
+), page AS (
+    SELECT * FROM ranked
+    WHERE sqlc.narg(cursor_rank)::real IS NULL
+       OR (ranked.rank, ranked.published_at, ranked.id) < (sqlc.narg(cursor_rank)::real, sqlc.narg(cursor_published_at)::timestamptz, sqlc.narg(cursor_id)::uuid)
+    ORDER BY ranked.rank DESC, ranked.published_at DESC, ranked.id DESC
+    LIMIT sqlc.arg(page_size)
+)
+-- Matches are delimited by the control characters 2 and 3, which are removed from the text
+-- first, so the snippet can be escaped before they become <mark> tags
+SELECT page.*,
+       ts_headline('english',
+           translate(regexp_replace(COALESCE(NULLIF(page.content, ''), NULLIF(page.description, ''), page.title), '<[^>]*>', ' ', 'g'), chr(2) || chr(3), ''),
+           search.tsquery,
+           'StartSel=' || chr(2) || ', StopSel=' || chr(3) || ', MaxFragments=2, MinWords=15, MaxWords=35')::text AS snippet
+FROM page
+CROSS JOIN search
+ORDER BY page.rank DESC, page.published_at DESC, page.id DESC;
\ No newline at end of file
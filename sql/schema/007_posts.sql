@@ -0,0 +1,9 @@
+-- +goose Up
+ALTER TABLE posts ADD COLUMN published_at_inferred BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Posts stored with an unparseable date were given the zero time
+UPDATE posts SET published_at = created_at, published_at_inferred = TRUE
+WHERE published_at < '1970-01-01';
+
+-- +goose Down
+ALTER TABLE posts DROP COLUMN published_at_inferred;
@@ -0,0 +1,15 @@
+-- +goose Up
+-- Posts stored before guids existed keep a NULL guid until the scraper sees them again
+-- and adopts them by url, as their original <guid> cannot be recovered here
+ALTER TABLE posts ADD COLUMN guid TEXT;
+CREATE INDEX posts_legacy_url_idx ON posts (feed_id, url) WHERE guid IS NULL;
+
+-- Posts are identified per feed, so two feeds may link the same url
+ALTER TABLE posts DROP CONSTRAINT posts_url_key;
+ALTER TABLE posts ADD CONSTRAINT posts_feed_id_guid_key UNIQUE (feed_id, guid);
+
+-- +goose Down
+ALTER TABLE posts DROP CONSTRAINT posts_feed_id_guid_key;
+ALTER TABLE posts ADD CONSTRAINT posts_url_key UNIQUE (url);
+DROP INDEX posts_legacy_url_idx;
+ALTER TABLE posts DROP COLUMN guid;
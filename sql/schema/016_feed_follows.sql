@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE feed_follows ADD COLUMN category TEXT;
+ALTER TABLE feed_follows ADD COLUMN title TEXT;
+
+-- +goose Down
+ALTER TABLE feed_follows DROP COLUMN title;
+ALTER TABLE feed_follows DROP COLUMN category;
@@ -0,0 +1,13 @@
+-- +goose Up
+ALTER TABLE posts ADD COLUMN author TEXT;
+ALTER TABLE posts ADD COLUMN categories TEXT[] NOT NULL DEFAULT '{}';
+CREATE INDEX posts_feed_id_published_at_idx ON posts (feed_id, published_at);
+CREATE INDEX posts_author_idx ON posts (LOWER(author));
+CREATE INDEX posts_categories_idx ON posts USING GIN (categories);
+
+-- +goose Down
+DROP INDEX posts_categories_idx;
+DROP INDEX posts_author_idx;
+DROP INDEX posts_feed_id_published_at_idx;
+ALTER TABLE posts DROP COLUMN categories;
+ALTER TABLE posts DROP COLUMN author;